@@ -2,338 +2,6530 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type HeaderInfo struct {
+	columnCount int
 	issueKeyIdx int
 	summaryIdx  int
 	statusIdx   int
+	teamIdx     int
+	priorityIdx int
+	pointsIdx   int
+	typeIdx     int
+	assigneeIdx int
+	parentIdx   []int
+	subtaskIdx  int
+	idIdx       int
+	categoryIdx int
 	blockedIdx  []int
 	blockerIdx  []int
+	labelIdx    []int
+	sprintIdx   []int
+	dueIdx      int
+	createdIdx  int
+	updatedIdx  int
+	descIdx     int
+	// linkColumns holds the columns of the -linkTypes links, other than Blocks.
+	linkColumns []LinkColumn
+	// badgeColumns holds the columns feeding config badges.
+	badgeColumns []BadgeColumn
+}
+
+type BadgeColumn struct {
+	idx   int
+	badge Badge
+}
+
+type LinkColumn struct {
+	idx      int
+	linkType string
+	outward  bool
+}
+
+// Link is a link of a type other than Blocks, from a ticket's outward side to its inward side.
+type Link struct {
+	linkType string
+	from     string
+	to       string
 }
 
 type IssueInfo struct {
 	issueKey    string
 	summary     string
+	description string
 	status      string
+	team        string
+	priority    string
+	points      float64
+	issueType   string
+	assignee    string
+	parent      string
+	subtasks    []string
+	issueId     string
+	labels      []string
+	badges      []string
+	sprints     []string
+	due         time.Time
+	created     time.Time
+	updated     time.Time
+	category    string
 	blockedKeys []string
 	blockerKeys []string
+	// chainedKeys holds blocked keys reached through tickets that were summarized
+	// away, with how many tickets each chain hides.
+	chainedKeys map[string]int
+	// blockedCounts and blockerCounts hold how many times this ticket's own rows recorded each link.
+	blockedCounts map[string]int
+	blockerCounts map[string]int
+	links         []Link
+	// duplicateKeys holds the tickets -mergeDuplicates folded into this one.
+	duplicateKeys []string
+	impact        int
+	centrality    float64
+	// placeholder is set for tickets only known as link targets, without rows of their own.
+	placeholder bool
+	// slack is how many days an open ticket with a due date downstream can slip, when scheduled.
+	slack     int
+	scheduled bool
+}
+
+// Internal names for the input fields JiraD understands.
+const (
+	fieldIssueKey = "issueKey"
+	fieldSummary  = "summary"
+	fieldStatus   = "status"
+	fieldBlocker  = "blocker"
+	fieldBlocked  = "blocked"
+	fieldTeam     = "team"
+	fieldPriority = "priority"
+	fieldPoints   = "points"
+	fieldType     = "issueType"
+	fieldCategory = "statusCategory"
+	fieldAssignee = "assignee"
+	fieldLabels   = "labels"
+	fieldSprints  = "sprints"
+	fieldDue      = "dueDate"
+	fieldCreated  = "created"
+	fieldUpdated  = "updated"
+	fieldDesc     = "description"
+	fieldParent   = "parent"
+	fieldIssueId  = "issueId"
+	fieldSubtasks = "subtasks"
+)
+
+// headerAliases holds the header names Jira uses for each field, by export language.
+var headerAliases = map[string]map[string][]string{
+	"en": {
+		fieldIssueKey: {"Issue key", "Key"},
+		fieldSummary:  {"Summary"},
+		fieldStatus:   {"Status"},
+		fieldBlocker:  {"Inward issue link (Blocks)"},
+		fieldBlocked:  {"Outward issue link (Blocks)"},
+		fieldPriority: {"Priority", "P"},
+		fieldPoints:   {"Custom field (Story Points)", "Custom field (Story point estimate)", "Story Points"},
+		fieldType:     {"Issue Type", "Type", "T"},
+		fieldCategory: {"Status Category"},
+		fieldAssignee: {"Assignee"},
+		fieldLabels:   {"Labels"},
+		fieldSprints:  {"Sprint"},
+		fieldDue:      {"Due Date", "Due date", "Due"},
+		fieldCreated:  {"Created"},
+		fieldUpdated:  {"Updated"},
+		fieldDesc:     {"Description"},
+		fieldParent:   {"Parent", "Parent key", "Parent id", "Custom field (Epic Link)", "Epic Link"},
+		fieldIssueId:  {"Issue id"},
+		fieldSubtasks: {"Sub-tasks", "Sub-Tasks"},
+	},
+	"de": {
+		fieldIssueKey: {"Vorgangsschlüssel", "Schlüssel"},
+		fieldSummary:  {"Zusammenfassung"},
+		fieldStatus:   {"Status"},
+		fieldBlocker:  {"Eingehende Vorgangsverknüpfung (Blocks)"},
+		fieldBlocked:  {"Ausgehende Vorgangsverknüpfung (Blocks)"},
+		fieldPriority: {"Priorität"},
+		fieldPoints:   {"Benutzerdefiniertes Feld (Story Points)"},
+		fieldType:     {"Vorgangstyp"},
+		fieldCategory: {"Statuskategorie"},
+		fieldAssignee: {"Bearbeiter"},
+		fieldLabels:   {"Stichwörter"},
+		fieldSprints:  {"Sprint"},
+		fieldDue:      {"Fälligkeitsdatum"},
+		fieldCreated:  {"Erstellt"},
+		fieldUpdated:  {"Aktualisiert"},
+		fieldDesc:     {"Beschreibung"},
+		fieldParent:   {"Übergeordnet", "Benutzerdefiniertes Feld (Epic Link)"},
+		fieldIssueId:  {"Vorgangs-ID"},
+		fieldSubtasks: {"Unteraufgaben"},
+	},
+	"fr": {
+		fieldIssueKey: {"Clé de ticket", "Clé"},
+		fieldSummary:  {"Résumé"},
+		fieldStatus:   {"État", "Statut"},
+		fieldBlocker:  {"Lien de ticket entrant (Blocks)"},
+		fieldBlocked:  {"Lien de ticket sortant (Blocks)"},
+		fieldPriority: {"Priorité"},
+		fieldPoints:   {"Champ personnalisé (Story Points)"},
+		fieldType:     {"Type de ticket"},
+		fieldCategory: {"Catégorie d'état"},
+		fieldAssignee: {"Responsable"},
+		fieldLabels:   {"Étiquettes"},
+		fieldSprints:  {"Sprint"},
+		fieldDue:      {"Date d'échéance"},
+		fieldCreated:  {"Création"},
+		fieldUpdated:  {"Mise à jour"},
+		fieldDesc:     {"Description"},
+		fieldParent:   {"Parent", "Champ personnalisé (Epic Link)"},
+		fieldIssueId:  {"ID de ticket"},
+		fieldSubtasks: {"Sous-tâches"},
+	},
+	"es": {
+		fieldIssueKey: {"Clave de incidencia", "Clave"},
+		fieldSummary:  {"Resumen"},
+		fieldStatus:   {"Estado"},
+		fieldBlocker:  {"Enlace de incidencia entrante (Blocks)"},
+		fieldBlocked:  {"Enlace de incidencia saliente (Blocks)"},
+		fieldPriority: {"Prioridad"},
+		fieldPoints:   {"Campo personalizado (Story Points)"},
+		fieldType:     {"Tipo de incidencia"},
+		fieldCategory: {"Categoría de estado"},
+		fieldAssignee: {"Responsable"},
+		fieldLabels:   {"Etiquetas"},
+		fieldSprints:  {"Sprint"},
+		fieldDue:      {"Fecha de vencimiento"},
+		fieldCreated:  {"Creada"},
+		fieldUpdated:  {"Actualizada"},
+		fieldDesc:     {"Descripción"},
+		fieldParent:   {"Principal", "Campo personalizado (Epic Link)"},
+		fieldIssueId:  {"ID de incidencia"},
+		fieldSubtasks: {"Subtareas"},
+	},
+	"pt": {
+		fieldIssueKey: {"Chave do item", "Chave da questão", "Chave"},
+		fieldSummary:  {"Resumo"},
+		fieldStatus:   {"Status", "Estado"},
+		fieldBlocker:  {"Link de item de entrada (Blocks)", "Link da questão de entrada (Blocks)"},
+		fieldBlocked:  {"Link de item de saída (Blocks)", "Link da questão de saída (Blocks)"},
+		fieldPriority: {"Prioridade"},
+		fieldPoints:   {"Campo personalizado (Story Points)"},
+		fieldType:     {"Tipo de item"},
+		fieldCategory: {"Categoria do status"},
+		fieldAssignee: {"Responsável"},
+		fieldLabels:   {"Etiquetas", "Rótulos"},
+		fieldSprints:  {"Sprint"},
+		fieldDue:      {"Data de entrega"},
+		fieldCreated:  {"Criado"},
+		fieldUpdated:  {"Atualizado"},
+		fieldDesc:     {"Descrição"},
+		fieldParent:   {"Pai", "Campo personalizado (Epic Link)"},
+		fieldIssueId:  {"ID do item"},
+		fieldSubtasks: {"Subtarefas"},
+	},
+	"ja": {
+		fieldIssueKey: {"課題キー", "キー"},
+		fieldSummary:  {"要約"},
+		fieldStatus:   {"ステータス"},
+		fieldBlocker:  {"内向きの課題リンク (Blocks)"},
+		fieldBlocked:  {"外向きの課題リンク (Blocks)"},
+		fieldPriority: {"優先度"},
+		fieldPoints:   {"カスタムフィールド (Story Points)"},
+		fieldType:     {"課題タイプ"},
+		fieldCategory: {"ステータスカテゴリ"},
+		fieldAssignee: {"担当者"},
+		fieldLabels:   {"ラベル"},
+		fieldSprints:  {"スプリント"},
+		fieldDue:      {"期限"},
+		fieldCreated:  {"作成日"},
+		fieldUpdated:  {"更新日"},
+		fieldDesc:     {"説明"},
+		fieldParent:   {"親", "カスタムフィールド (Epic Link)"},
+		fieldIssueId:  {"課題 ID"},
+		fieldSubtasks: {"サブタスク"},
+	},
+}
+
+// Palette is a coordinated set of diagram colors. Empty colors keep PlantUML's defaults.
+type Palette struct {
+	Background string `json:"background,omitempty"`
+	Node       string `json:"node,omitempty"`
+	Border     string `json:"border,omitempty"`
+	Font       string `json:"font,omitempty"`
+	Edge       string `json:"edge,omitempty"`
+	// Highlight replaces -highlightColor's default.
+	Highlight string `json:"highlight,omitempty"`
+	// Statuses colors tickets by status category: "To Do", "In Progress" or "Done".
+	Statuses map[string]string `json:"statuses,omitempty"`
+	// Groups are handed out in turn to groups of tickets, such as project packages.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// palettes holds the built-in palettes for -palette.
+var palettes = map[string]Palette{
+	"dark": {
+		Background: "#1E1E1E",
+		Node:       "#2D2D30",
+		Border:     "#9CDCFE",
+		Font:       "#D4D4D4",
+		Edge:       "#9CDCFE",
+		Highlight:  "#2E5E3E",
+	},
+	"light": {
+		Highlight: "paleGreen",
+		Statuses: map[string]string{
+			"To Do":       "#E3F2FD",
+			"In Progress": "#FFF9C4",
+			"Done":        "#E8F5E9",
+		},
+		Groups: []string{"#FAFAFA", "#FFF3E0", "#F3E5F5", "#E0F7FA", "#FBE9E7"},
+	},
+	// colorblind uses the Okabe-Ito colors, which stay distinct for all common color vision deficiencies.
+	"colorblind": {
+		Highlight: "#E69F00",
+		Statuses: map[string]string{
+			"To Do":       "#56B4E9",
+			"In Progress": "#F0E442",
+			"Done":        "#009E73",
+		},
+		Groups: []string{"#CC79A7", "#0072B2", "#D55E00", "#999999"},
+	},
+}
+
+// Report collects what went wrong while reading, to be summarized once the run ends.
+type Report struct {
+	malformedRows []MalformedRow
+	firstRows     map[string]IssueInfo
+	duplicates    map[string]*DuplicateKey
+	selfLinks     map[string]struct{}
+	danglingKeys  []string
+	// contradictions holds pairs of tickets linked both ways by only one side's rows.
+	contradictions [][2]string
+	centrality     map[string]float64
+	// hiddenKeys holds the -hideKeys tickets the input had, and filtered the tickets every
+	// later filter rule hid, in the order the rules ran.
+	hiddenKeys map[string]struct{}
+	filtered   []FilterCount
+}
+
+// FilterCount is how many tickets a filter rule hid.
+type FilterCount struct {
+	rule    string
+	tickets int
+}
+
+type MalformedRow struct {
+	source string
+	line   int
+	reason string
+	raw    string
+}
+
+// DuplicateKey tracks an issue key found in more than one row, and which
+// fields differed from its first row.
+type DuplicateKey struct {
+	rows      int
+	conflicts []string
+}
+
+// Config holds settings read from the -config file.
+type Config struct {
+	// Headers maps fields to extra header names, checked before the built-in ones.
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Profiles holds named sets of option values, keyed by option name, for -profile.
+	Profiles map[string]map[string]any `json:"profiles,omitempty"`
+	// IssueTypeIcons maps issue types to PlantUML text (an OpenIconic icon like
+	// "<&bug>" or a sprite like "<$epic>") shown before each ticket's status.
+	IssueTypeIcons map[string]string `json:"issueTypeIcons,omitempty"`
+	// StatusIcons maps status categories ("To Do", "In Progress", "Done") to an emoji or icon
+	// shown before each ticket's status, after any issue type icon.
+	StatusIcons map[string]string `json:"statusIcons,omitempty"`
+	// Palettes holds custom palettes for -palette, which win over built-ins of the same name.
+	Palettes map[string]Palette `json:"palettes,omitempty"`
+	// Skinparams are emitted after the header, before any given with -skinparam.
+	Skinparams []string `json:"skinparams,omitempty"`
+	// LinkStyles maps -linkTypes link types to PlantUML line styles, like "#999999,dashed".
+	LinkStyles map[string]string `json:"linkStyles,omitempty"`
+	// Projects holds overrides for the issues of each project, keyed by project key.
+	Projects map[string]ProjectConfig `json:"projects,omitempty"`
+	// AutoPrune adds statuses and issue types whose leaves -autoPrune drops, besides done ones.
+	AutoPrune AutoPruneConfig `json:"autoPrune,omitempty"`
+	// Stereotypes adds PlantUML stereotypes to tickets by type, status or origin, styled in the header.
+	Stereotypes StereotypeConfig `json:"stereotypes,omitempty"`
+	// Badges are small marks, like "<&warning>", shown in the title of tickets whose field matches.
+	Badges []Badge `json:"badges,omitempty"`
+	// ApiKeys holds the keys the serve command accepts, with what each may see. When there are
+	// none, the serve endpoints are open.
+	ApiKeys map[string]ApiKey `json:"apiKeys,omitempty"`
+}
+
+// AutoPruneConfig lists low-value tickets for -autoPrune, matched case-insensitively.
+type AutoPruneConfig struct {
+	Statuses   []string `json:"statuses,omitempty"`
+	IssueTypes []string `json:"issueTypes,omitempty"`
+}
+
+// StereotypeConfig assigns stereotypes, like "bug" for <<bug>>, to tickets. Type and status names
+// are matched case-insensitively; Placeholder goes to linked tickets without rows of their own.
+type StereotypeConfig struct {
+	IssueTypes  map[string]string `json:"issueTypes,omitempty"`
+	Statuses    map[string]string `json:"statuses,omitempty"`
+	Placeholder string            `json:"placeholder,omitempty"`
+	// Styles maps stereotypes to object skinparams without the "object" prefix, like
+	// "BackgroundColor" or "BorderThickness", and their values.
+	Styles map[string]map[string]string `json:"styles,omitempty"`
+}
+
+// Badge marks tickets whose Field column holds Value (case-insensitive), or anything when Value is empty.
+type Badge struct {
+	Field string `json:"field"`
+	Value string `json:"value,omitempty"`
+	Badge string `json:"badge"`
+}
+
+// ApiKey restricts what the serve requests authorized by one key may see.
+type ApiKey struct {
+	// Projects are the project keys whose tickets the requests get; all of them when empty.
+	Projects []string `json:"projects,omitempty"`
+	// Profiles are the profiles whose sites the key may use; all of them, and the unprefixed
+	// one, when empty.
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+// ProjectConfig overrides defaults for the issues of one project.
+type ProjectConfig struct {
+	// Color is the background for the project's tickets unless something else colors them.
+	Color string `json:"color,omitempty"`
+	// Hide drops all the project's tickets; HideStatuses drops those in the given statuses.
+	Hide         bool     `json:"hide,omitempty"`
+	HideStatuses []string `json:"hideStatuses,omitempty"`
+	// Group draws the project's tickets inside a package of that name.
+	Group string `json:"group,omitempty"`
+}
+
+// Output is a file to write, and its format (one of outputFormats).
+type Output struct {
+	filename string
+	format   string
+	compress bool
 }
 
 type Options struct {
 	inFilename           string
 	outFilename          string
+	outputs              []Output
 	supplementalFilename string
 	hideSummary          bool
 	hideOrphans          bool
 	hideKeys             map[string]struct{}
 	showKeys             map[string]struct{}
 	highlightKeys        map[string]struct{}
+	highlightKeyColors   map[string]string
 	highlightColor       string
+	highlightAssignees   map[string]string
+	highlightLabels      map[string]string
+	highlightNew         bool
+	sizeByPoints         bool
+	linkCounts           bool
+	edgeColorByBlocker   bool
+	linkTypes            map[string]struct{}
+	mergeDuplicates      bool
+	groupByParent        bool
+	groupByTeam          bool
+	teams                map[string]struct{}
+	teamMap              map[string]string
+	parentLinks          bool
+	stateFilename        string
+	previousState        map[string]struct{}
 	wrapWidth            int
+	rollup               string
+	layout               string
+	maxNodes             int
+	pages                [][]string
+	pageFiles            []string
+	aliasStyle           string
+	aliases              map[string]string
+	rankBy               string
+	annotateEpicDeps     bool
+	teamField            string
+	blockerColumns       []string
+	blockedColumns       []string
+	teamMapFilename      string
+	aliasesFilename      string
+	appendFilename       string
+	sitePrefixes         []string
+	logFormat            string
+	listen               string
+	maxUpload            int
+	allowedProjects      map[string]struct{}
+	notifyUrl            string
+	quiet                bool
+	lang                 string
+	configFilename       string
+	config               Config
+	verbose              bool
+	errorFilename        string
+	strictDuplicates     bool
+	roots                map[string]struct{}
+	failIfBlocked        map[string]struct{}
+	failOnCycle          bool
+	endpointsOnly        bool
+	autoPrune            bool
+	outSet               bool
+	highlightColorSet    bool
+	plantUmlServerSet    bool
+	showImpact           bool
+	showSlack            bool
+	showAge              bool
+	ageColors            map[int]string
+	staleAfter           int
+	readBuffer           int
+	daysPerPoint         float64
+	doneStatuses         map[string]struct{}
+	metrics              string
+	metricsShading       bool
+	maxDepth             int
+	arguments            []string
+	clipboard            bool
+	open                 bool
+	plantUmlServer       string
+	theme                string
+	skinparams           []string
+	together             []map[string]struct{}
+	includeFilename      string
+	epilogueFilename     string
+	palette              Palette
+	keysFilename         string
+	fileKeys             map[string]struct{}
+	keysNeighbors        bool
+	settings             []string
+	inputHashes          map[string]string
+	reproducible         bool
+	now                  time.Time
 }
 
+// version is JiraD's release, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
-	options := loadOptions()
-	inFile, err := os.Open(options.inFilename)
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	options, err := loadOptions(args)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "can't read input file (%s): %v\n", options.inFilename, err)
+		_, _ = fmt.Fprintf(os.Stderr, "can't load options: %v\n", err)
 		os.Exit(1)
 	}
-	outFile, err := os.Create(options.outFilename)
-	if err != nil {
-		_ = inFile.Close()
-		_, _ = fmt.Fprintf(os.Stderr, "can't create output file (%s): %v\n", options.outFilename, err)
+	if err := validateOptions(options); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid options: %v\n", err)
 		os.Exit(1)
 	}
 
-	err = process(inFile, outFile, options)
-	_ = inFile.Close()
-	_ = outFile.Close()
+	switch command {
+	case "":
+		err = runDiagram(options)
+	case "impact":
+		err = runImpact(options, options.arguments)
+	case "rank":
+		err = runRank(options)
+	case "path":
+		err = runPath(options, options.arguments)
+	case "paths":
+		err = runPaths(options, options.arguments)
+	case "init":
+		err = runInit(options)
+	case "serve":
+		err = runServe(options, args)
+	case "detail":
+		err = runDetail(options, options.arguments)
+	case "ready":
+		err = runReady(options, options.arguments)
+	default:
+		err = fmt.Errorf("unknown command '%s'", command)
+	}
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "processing failed: %v\n", err)
+		logEvent(options, "error", "failed", map[string]any{"message": err.Error()}, err.Error())
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
-func loadOptions() Options {
-	inFilename := flag.String("in", "tickets.csv", "the file to process")
-	outFilename := flag.String("out", "tickets.txt", "the file to create")
-	supplementalFilename := flag.String("supplemental", "", "supplemental file to process")
-	hideSummary := flag.Bool("hideSummary", false, "don't show ticket summaries")
-	hideOrphans := flag.Bool("hideOrphans", true, "don't show tickets without relationships")
-	hideKeys := flag.String("hideKeys", "", "don't show these tickets (comma delimited)")
-	showKeys := flag.String("showKeys", "", "always show these tickets (comma delimited)")
-	highlightKeys := flag.String("highlightKeys", "", "highlight these tickets (comma delimited)")
-	highlightColor := flag.String("highlightColor", "paleGreen", "color for highlightKeys")
-	wrapWidth := flag.Int("wrapWidth", 150, "Point at which to start wrapping text")
-	flag.Parse()
-
-	var options Options
-	options.inFilename = *inFilename
-	options.outFilename = *outFilename
-	options.supplementalFilename = *supplementalFilename
-	options.hideSummary = *hideSummary
-	options.hideOrphans = *hideOrphans
-	options.hideKeys = parseKeys(*hideKeys)
-	options.showKeys = parseKeys(*showKeys)
-	options.highlightKeys = parseKeys(*highlightKeys)
-	options.highlightColor = *highlightColor
-	options.wrapWidth = *wrapWidth
-
-	return options
+// exitError is a result scripts can tell apart from failures by its exit code.
+type exitError struct {
+	code    int
+	message string
 }
 
-func process(inFile *os.File, outFile *os.File, options Options) error {
-	issues := make(map[string]IssueInfo)
+func (e *exitError) Error() string {
+	return e.message
+}
 
-	err := processSupplementalFile(options, &issues)
+// readInput reads -in (and -supplemental) for commands that don't write a diagram.
+// Under -reproducible, it also sets the options' now from the input.
+func readInput(options *Options, report *Report) (map[string]IssueInfo, error) {
+	inFile, err := os.Open(options.inFilename)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Problem processing supplemental: %v. Continuing.", err)
+		return nil, fmt.Errorf("can't read input file (%s): %v", options.inFilename, err)
 	}
-
-	err = processFile(inFile, options, &issues)
+	issues, err := readAllIssues(inFile, *options, report)
+	_ = inFile.Close()
 	if err != nil {
-		return fmt.Errorf("input failure: %v", err)
+		return nil, fmt.Errorf("processing failed: %v", err)
 	}
+	options.now = inputNow(&issues, *options)
+	return issues, nil
+}
 
-	fillDependencies(&issues)
+// inputNow is the run's start, or under -reproducible the latest Updated or Created date of
+// the input, so ages, staleness and slack stay the same for the same input. An input without
+// such dates falls back to the run's start.
+func inputNow(issues *map[string]IssueInfo, options Options) time.Time {
+	if !options.reproducible {
+		return options.now
+	}
+	var latest time.Time
+	for _, issue := range *issues {
+		for _, date := range []time.Time{issue.updated, issue.created} {
+			if date.After(latest) {
+				latest = date
+			}
+		}
+	}
+	if latest.IsZero() {
+		return options.now
+	}
+	return latest
+}
 
-	err = writeOutput(&issues, outFile, options)
+func runDiagram(options Options) error {
+	inFile, err := os.Open(options.inFilename)
 	if err != nil {
-		return fmt.Errorf("output failure: %v", err)
+		return fmt.Errorf("can't read input file (%s): %v", options.inFilename, err)
+	}
+	var outFiles []io.Writer
+	defer func() {
+		for _, outFile := range outFiles {
+			closeOutput(outFile.(*os.File))
+		}
+	}()
+	for _, output := range options.outputs {
+		outFile, err := createOutput(output.filename)
+		if err != nil {
+			_ = inFile.Close()
+			return fmt.Errorf("can't create output file (%s): %v", output.filename, err)
+		}
+		outFiles = append(outFiles, outFile)
 	}
 
-	return nil
-}
+	// An exitError, e.g. of -failIfBlocked, still leaves a diagram to copy and open.
+	result := process(inFile, outFiles, options)
+	_ = inFile.Close()
+	var exitErr *exitError
+	if result != nil && !errors.As(result, &exitErr) {
+		return fmt.Errorf("processing failed: %v", result)
+	}
 
-func processSupplementalFile(options Options, issues *map[string]IssueInfo) error {
-	if len(options.supplementalFilename) > 0 {
-		supplementalFile, err := os.Open(options.supplementalFilename)
+	if options.clipboard {
+		err = copyToClipboard(options.outFilename)
 		if err != nil {
-			return fmt.Errorf("couldn't open: %v", err)
+			return fmt.Errorf("clipboard failure: %v", err)
 		}
-		err = processFile(supplementalFile, options, issues)
+	}
+	if options.open {
+		err = openOnServer(options.outFilename, options)
 		if err != nil {
-			return fmt.Errorf("processing problem: %v", err)
+			return fmt.Errorf("open failure: %v", err)
 		}
-		_ = supplementalFile.Close()
 	}
-	return nil
+	return result
 }
 
-func processFile(file *os.File, options Options, issues *map[string]IssueInfo) error {
-	input := bufio.NewScanner(file)
-	headerInfo, err := readHeader(input)
-	if err != nil {
-		return fmt.Errorf("header failure: %v", err)
+// runServe serves POST /graphs, which renders an uploaded export (the "input" form file) with the
+// server's own options, those of the "options" JSON form value on top, in the "format" asked for.
+// DELETE /cache empties the cache of rendered diagrams, and GET /metrics counts the site's work.
+// Each -config profile is served the same way under its name, e.g. /site-a/graphs, with the
+// profile's options and a cache and counters of its own.
+func runServe(options Options, args []string) error {
+	mux := http.NewServeMux()
+	serveSite(mux, "", args, options.config)
+	for _, name := range sortedKeys(options.config.Profiles) {
+		serveSite(mux, name, append(append([]string{}, args...), "-profile="+name), options.config)
 	}
-	readIssues(input, &headerInfo, options, issues)
-	return nil
+	logEvent(options, "info", "serving", map[string]any{"address": options.listen}, "serving on "+options.listen)
+	return http.ListenAndServe(options.listen, mux)
 }
 
-func readHeader(input *bufio.Scanner) (HeaderInfo, error) {
-	var headerInfo HeaderInfo
-	headerInfo.issueKeyIdx = -1
-	headerInfo.summaryIdx = -1
-	headerInfo.statusIdx = -1
+// serveSite serves /graphs, /graph, /events, /cache and /metrics for a profile, under /profile when it's named.
+func serveSite(mux *http.ServeMux, profile string, args []string, config Config) {
+	prefix := ""
+	if len(profile) > 0 {
+		prefix = "/" + profile
+	}
+	cache := &graphCache{diagrams: make(map[string][]byte)}
+	metrics := &siteMetrics{}
+	watcher := &inputWatcher{listeners: make(map[chan string]struct{})}
+	// the site's requests fail on its options anyway when they don't parse
+	maxUpload := int64(100 << 20)
+	if options, err := parseRequestOptions(args, nil); err == nil {
+		maxUpload = int64(options.maxUpload)
+		go watcher.watch(options.inFilename)
+	}
+	mux.HandleFunc(prefix+"/events", func(writer http.ResponseWriter, request *http.Request) {
+		if _, authorized := authorize(request, config, profile); !authorized {
+			http.Error(writer, "missing API key, or not one for this site", http.StatusUnauthorized)
+			return
+		}
+		watcher.serveEvents(writer, request)
+	})
+	mux.HandleFunc(prefix+"/graphs", func(writer http.ResponseWriter, request *http.Request) {
+		apiKey, authorized := authorize(request, config, profile)
+		if !authorized {
+			http.Error(writer, "missing API key, or not one for this site", http.StatusUnauthorized)
+			return
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, maxUpload)
+		serveGraph(writer, request, args, apiKey, cache, metrics)
+	})
+	mux.HandleFunc(prefix+"/graph", func(writer http.ResponseWriter, request *http.Request) {
+		apiKey, authorized := authorize(request, config, profile)
+		if !authorized {
+			http.Error(writer, "missing API key, or not one for this site", http.StatusUnauthorized)
+			return
+		}
+		serveGraphJson(writer, request, args, apiKey, cache, metrics)
+	})
+	mux.HandleFunc(prefix+"/cache", func(writer http.ResponseWriter, request *http.Request) {
+		if _, authorized := authorize(request, config, profile); !authorized {
+			http.Error(writer, "missing API key, or not one for this site", http.StatusUnauthorized)
+			return
+		}
+		if request.Method != http.MethodDelete {
+			http.Error(writer, "DELETE "+prefix+"/cache to empty it", http.StatusMethodNotAllowed)
+			return
+		}
+		cache.clear()
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc(prefix+"/metrics", func(writer http.ResponseWriter, request *http.Request) {
+		if _, authorized := authorize(request, config, profile); !authorized {
+			http.Error(writer, "missing API key, or not one for this site", http.StatusUnauthorized)
+			return
+		}
+		if request.Method != http.MethodGet {
+			http.Error(writer, "GET "+prefix+"/metrics for the site's counters", http.StatusMethodNotAllowed)
+			return
+		}
+		metrics.serve(writer)
+	})
+}
 
-	input.Scan()
-	columns := strings.Split(input.Text(), ",")
-	for i, col := range columns {
-		switch col {
-		case "Issue key":
-			headerInfo.issueKeyIdx = i
+// siteMetrics counts a site's rendering since the server started, for GET /metrics.
+type siteMetrics struct {
+	rendered    atomic.Int64
+	parseErrors atomic.Int64
+	cacheHits   atomic.Int64
+}
 
-		case "Summary":
-			headerInfo.summaryIdx = i
+// serve writes the counters in the Prometheus text format. There's no Jira API latency to
+// report, since JiraD reads exports and never calls Jira.
+func (metrics *siteMetrics) serve(writer http.ResponseWriter) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, counter := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"jirad_diagrams_rendered_total", "Diagrams rendered, not counting those served from the cache.", metrics.rendered.Load()},
+		{"jirad_parse_errors_total", "Exports that failed processing.", metrics.parseErrors.Load()},
+		{"jirad_cache_hits_total", "Diagrams served from the cache.", metrics.cacheHits.Load()},
+	} {
+		_, _ = fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", counter.name, counter.help, counter.name, counter.name, counter.value)
+	}
+	_, _ = fmt.Fprint(writer, "# Jira API latency: not applicable, JiraD reads exports and never calls Jira\n")
+}
 
-		case "Status":
-			headerInfo.statusIdx = i
+// authorize finds the -config API key a serve request gives as "Authorization: Bearer KEY", if
+// it may use the profile's site ("" for the unprefixed one). Every request is authorized, with
+// no restrictions, when the config holds no keys.
+func authorize(request *http.Request, config Config, profile string) (ApiKey, bool) {
+	if len(config.ApiKeys) == 0 {
+		return ApiKey{}, true
+	}
+	given, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ApiKey{}, false
+	}
+	for key, apiKey := range config.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(given)) == 1 {
+			return apiKey, len(apiKey.Profiles) == 0 || containsKey(&apiKey.Profiles, profile)
+		}
+	}
+	return ApiKey{}, false
+}
 
-		case "Inward issue link (Blocks)":
-			headerInfo.blockerIdx = append(headerInfo.blockerIdx, i)
+// watchInterval is how often the serve command checks each site's -in export for changes.
+const watchInterval = 2 * time.Second
 
-		case "Outward issue link (Blocks)":
-			headerInfo.blockedIdx = append(headerInfo.blockedIdx, i)
+// inputWatcher tells the /events listeners of a site when its -in export changes, so pages
+// showing GET /graph can refresh without polling.
+type inputWatcher struct {
+	lock      sync.Mutex
+	listeners map[chan string]struct{}
+}
+
+// watch checks the file's modification time and size every watchInterval, sending a "changed"
+// event with them to every listener when either differs.
+func (watcher *inputWatcher) watch(filename string) {
+	previous, _ := os.Stat(filename)
+	for range time.Tick(watchInterval) {
+		current, err := os.Stat(filename)
+		if err != nil || (previous != nil && current.ModTime().Equal(previous.ModTime()) && current.Size() == previous.Size()) {
+			continue
 		}
+		previous = current
+		data, _ := json.Marshal(map[string]any{"input": filename, "modified": current.ModTime().Format(time.RFC3339)})
+		watcher.lock.Lock()
+		for listener := range watcher.listeners {
+			select {
+			case listener <- string(data):
+			default:
+			}
+		}
+		watcher.lock.Unlock()
 	}
-	if headerInfo.issueKeyIdx == -1 {
-		return headerInfo, fmt.Errorf("'Issue key' not found\n")
+}
+
+// serveEvents streams the watcher's events to one client as Server-Sent Events until it leaves.
+func (watcher *inputWatcher) serveEvents(writer http.ResponseWriter, request *http.Request) {
+	flusher, canFlush := writer.(http.Flusher)
+	if !canFlush {
+		http.Error(writer, "streaming unsupported", http.StatusInternalServerError)
+		return
 	}
+	listener := make(chan string, 1)
+	watcher.lock.Lock()
+	watcher.listeners[listener] = struct{}{}
+	watcher.lock.Unlock()
+	defer func() {
+		watcher.lock.Lock()
+		delete(watcher.listeners, listener)
+		watcher.lock.Unlock()
+	}()
 
-	return headerInfo, nil
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case data := <-listener:
+			_, _ = fmt.Fprintf(writer, "event: changed\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
 }
 
-func readIssues(input *bufio.Scanner, headerInfo *HeaderInfo, options Options, issues *map[string]IssueInfo) {
-	for input.Scan() {
-		columns := strings.Split(input.Text(), ",")
-		if len(columns) > headerInfo.issueKeyIdx {
-			issueKey := strings.TrimSpace(columns[headerInfo.issueKeyIdx])
-			if len(issueKey) > 0 {
-				_, hideIt := (options.hideKeys)[issueKey]
-				_, showIt := (options.showKeys)[issueKey]
-				if showIt || !hideIt {
-					var issue IssueInfo
-					issue.issueKey = issueKey
-					if headerInfo.summaryIdx != -1 && len(columns) > headerInfo.summaryIdx {
-						issue.summary = columns[headerInfo.summaryIdx]
-					}
-					if headerInfo.statusIdx != -1 && len(columns) > headerInfo.statusIdx {
-						issue.status = columns[headerInfo.statusIdx]
-					}
-					loadBlockers(headerInfo, &columns, options, &issue, issues)
-					loadBlocked(headerInfo, &columns, options, &issue, issues)
+// graphCacheSize is how many rendered diagrams the serve command keeps.
+const graphCacheSize = 100
 
-					if existing, found := (*issues)[issue.issueKey]; found {
-						merge(&existing, &issue, issues)
-					} else {
-						(*issues)[issue.issueKey] = issue
-					}
-				}
-			}
-		}
+// graphCache holds rendered diagrams by their ETag, which hashes the input, options and format,
+// dropping the oldest when full.
+type graphCache struct {
+	lock     sync.Mutex
+	diagrams map[string][]byte
+	order    []string
+}
+
+func (cache *graphCache) get(etag string) ([]byte, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	diagram, found := cache.diagrams[etag]
+	return diagram, found
+}
+
+func (cache *graphCache) put(etag string, diagram []byte) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if _, found := cache.diagrams[etag]; !found {
+		cache.order = append(cache.order, etag)
+	}
+	cache.diagrams[etag] = diagram
+	for len(cache.order) > graphCacheSize {
+		delete(cache.diagrams, cache.order[0])
+		cache.order = cache.order[1:]
 	}
 }
 
-func merge(target *IssueInfo, source *IssueInfo, issues *map[string]IssueInfo) {
-	if len(target.summary) == 0 {
-		target.summary = source.summary
+func (cache *graphCache) clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.diagrams = make(map[string][]byte)
+	cache.order = nil
+}
+
+// requestForbidden are the options requests can't set, since they name files on the server or act on it.
+// A request's profile would pick another site's options, and its input, past the site's API key check,
+// and its plantumlServer or notify would have the server fetch or post to any URL the request names.
+// A request's readBuffer would be allocated in full however large it names.
+var requestForbidden = map[string]struct{}{
+	"in": {}, "out": {}, "format": {}, "supplemental": {}, "config": {}, "stateFile": {}, "append": {}, "profile": {},
+	"errorFile": {}, "teamMap": {}, "aliases": {}, "keysFile": {}, "include": {}, "epilogue": {},
+	"clipboard": {}, "open": {}, "listen": {}, "maxUpload": {}, "failIfBlocked": {}, "failOnCycle": {},
+	"annotateEpicDeps": {}, "maxNodes": {}, "plantumlServer": {}, "notify": {}, "readBuffer": {},
+}
+
+// contentTypes are the response types of the formats POST /graphs writes.
+var contentTypes = map[string]string{
+	"plantuml":  "text/plain; charset=utf-8",
+	"json":      "application/json",
+	"dot":       "text/vnd.graphviz; charset=utf-8",
+	"mermaid":   "text/plain; charset=utf-8",
+	"svg":       "image/svg+xml",
+	"embed":     "text/html; charset=utf-8",
+	"msproject": "application/xml",
+	"links":     "text/csv; charset=utf-8",
+	"ics":       "text/calendar; charset=utf-8",
+}
+
+func serveGraph(writer http.ResponseWriter, request *http.Request, args []string, apiKey ApiKey, cache *graphCache,
+	metrics *siteMetrics) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "POST an export to /graphs", http.StatusMethodNotAllowed)
+		return
 	}
-	if len(target.status) == 0 {
-		target.status = source.status
+	upload, _, err := request.FormFile("input")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(writer, fmt.Sprintf("request larger than %d MB (-maxUpload)", tooLarge.Limit>>20), http.StatusRequestEntityTooLarge)
+		return
 	}
-	for _, blockerKey := range source.blockerKeys {
-		if !containsKey(&(*target).blockerKeys, blockerKey) {
-			(*target).blockerKeys = append((*target).blockerKeys, blockerKey)
-		}
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("no input file: %v", err), http.StatusBadRequest)
+		return
 	}
-	for _, blockedKey := range source.blockedKeys {
-		if !containsKey(&(*target).blockedKeys, blockedKey) {
-			(*target).blockedKeys = append((*target).blockedKeys, blockedKey)
+	defer func() { _ = upload.Close() }()
+	overrides := make(map[string]any)
+	if text := request.FormValue("options"); len(text) > 0 {
+		if err := json.Unmarshal([]byte(text), &overrides); err != nil {
+			http.Error(writer, fmt.Sprintf("options aren't a JSON object: %v", err), http.StatusBadRequest)
+			return
 		}
 	}
+	if err := checkOverrides(overrides); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := request.FormValue("format")
+	switch format {
+	case "":
+		format = "plantuml"
+	case "puml":
+		format = "plantuml"
+	}
+	if _, known := contentTypes[format]; !known {
+		http.Error(writer, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+		return
+	}
 
-	(*issues)[target.issueKey] = *target
+	inFile, err := os.CreateTemp("", "jirad-*")
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("can't store input: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = inFile.Close()
+		_ = os.Remove(inFile.Name())
+	}()
+	if _, err := io.Copy(inFile, upload); err != nil {
+		http.Error(writer, fmt.Sprintf("can't store input: %v", err), http.StatusInternalServerError)
+		return
+	}
+	renderGraph(writer, request, inFile, args, overrides, format, apiKey, cache, metrics)
 }
 
-func loadBlockers(headerInfo *HeaderInfo, columns *[]string, options Options, issue *IssueInfo, issues *map[string]IssueInfo) {
-	for _, idx := range headerInfo.blockerIdx {
-		if len(*columns) > idx {
-			blockerKey := (*columns)[idx]
-			if len(blockerKey) > 0 {
-				_, hideBlocker := (options.hideKeys)[blockerKey]
-				if !hideBlocker {
-					issue.blockerKeys = append(issue.blockerKeys, blockerKey)
-					_, ok := (*issues)[blockerKey]
-					if !ok {
-						var blocker IssueInfo
-						blocker.issueKey = blockerKey
-						blocker.blockedKeys = append(blocker.blockerKeys, issue.issueKey)
-						(*issues)[blockerKey] = blocker
-					}
-				}
-			}
+// serveGraphJson serves GET /graph: the site's own -in export as -format json, for custom
+// frontends, with the query parameters (e.g. ?roots=ABC-1) as options on top.
+func serveGraphJson(writer http.ResponseWriter, request *http.Request, args []string, apiKey ApiKey, cache *graphCache,
+	metrics *siteMetrics) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "GET /graph for the graph as JSON", http.StatusMethodNotAllowed)
+		return
+	}
+	overrides := make(map[string]any)
+	for name, values := range request.URL.Query() {
+		if len(values) == 1 {
+			overrides[name] = values[0]
+			continue
 		}
+		var list []any
+		for _, value := range values {
+			list = append(list, value)
+		}
+		overrides[name] = list
+	}
+	if err := checkOverrides(overrides); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	options, err := parseRequestOptions(args, overrides)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("invalid options: %v", err), http.StatusBadRequest)
+		return
 	}
+	inFile, err := os.Open(options.inFilename)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("can't read input: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = inFile.Close() }()
+	renderGraph(writer, request, inFile, args, overrides, "json", apiKey, cache, metrics)
 }
 
-func loadBlocked(headerInfo *HeaderInfo, columns *[]string, options Options, issue *IssueInfo, issues *map[string]IssueInfo) {
-	for _, idx := range headerInfo.blockedIdx {
-		if len(*columns) > idx {
-			blockedKey := (*columns)[idx]
-			if len(blockedKey) > 0 {
-				_, hideBlocked := (options.hideKeys)[blockedKey]
-				if !hideBlocked {
-					issue.blockedKeys = append(issue.blockedKeys, blockedKey)
-					_, ok := (*issues)[blockedKey]
-					if !ok {
-						var blocked IssueInfo
-						blocked.issueKey = blockedKey
-						blocked.blockerKeys = append(blocked.blockerKeys, issue.issueKey)
-						(*issues)[blockedKey] = blocked
-					}
+// checkOverrides refuses the requestForbidden options and '@file' key lists, wherever the '@file'
+// entry is among a value's comma-separated keys or a list's items.
+func checkOverrides(overrides map[string]any) error {
+	for _, option := range sortedKeys(overrides) {
+		if _, forbidden := requestForbidden[option]; forbidden {
+			return fmt.Errorf("requests can't set '%s' to that", option)
+		}
+		values := []any{overrides[option]}
+		if list, isList := overrides[option].([]any); isList {
+			values = list
+		}
+		for _, value := range values {
+			for _, entry := range strings.Split(fmt.Sprint(value), ",") {
+				if strings.HasPrefix(strings.TrimSpace(entry), "@") {
+					return fmt.Errorf("requests can't set '%s' to that", option)
 				}
 			}
 		}
 	}
+	return nil
 }
 
-func fillDependencies(issues *map[string]IssueInfo) {
-	for _, issue := range *issues {
-		for _, blockerKey := range issue.blockerKeys {
-			if blocker, found := (*issues)[blockerKey]; found {
-				if !containsKey(&blocker.blockedKeys, issue.issueKey) {
-					blocker.blockedKeys = append(blocker.blockedKeys, issue.issueKey)
-					(*issues)[blocker.issueKey] = blocker
-				}
-			} else {
-				_, _ = fmt.Fprintf(os.Stdout, "Blocker not found: %s", blockerKey)
+// parseRequestOptions reads a serve request's options: the site's args, then its overrides.
+func parseRequestOptions(args []string, overrides map[string]any) (Options, error) {
+	flags := flag.NewFlagSet("jirad", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return parseOptions(flags, args, overrides)
+}
+
+// renderGraph writes the diagram of inFile in format, from the cache when it holds the ETag of
+// the input, options and format, or as a 304 when the client does, counting it in metrics.
+func renderGraph(writer http.ResponseWriter, request *http.Request, inFile *os.File, args []string,
+	overrides map[string]any, format string, apiKey ApiKey, cache *graphCache, metrics *siteMetrics) {
+	hash := sha256.New()
+	_, _ = inFile.Seek(0, io.SeekStart)
+	if _, err := io.Copy(hash, inFile); err != nil {
+		http.Error(writer, fmt.Sprintf("can't read input: %v", err), http.StatusInternalServerError)
+		return
+	}
+	_, _ = inFile.Seek(0, io.SeekStart)
+
+	// json.Marshal sorts the option names, so equal options hash alike however they were ordered
+	optionsText, _ := json.Marshal(overrides)
+	_, _ = fmt.Fprintf(hash, "\n%s\n%s\n%s", optionsText, format, strings.Join(apiKey.Projects, ","))
+	etag := fmt.Sprintf("\"%x\"", hash.Sum(nil))
+	writer.Header().Set("ETag", etag)
+	if request.Header.Get("If-None-Match") == etag {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if diagram, found := cache.get(etag); found {
+		metrics.cacheHits.Add(1)
+		writer.Header().Set("Content-Type", contentTypes[format])
+		_, _ = writer.Write(diagram)
+		return
+	}
+
+	options, err := parseRequestOptions(args, overrides)
+	if err == nil {
+		options.inFilename = inFile.Name()
+		options.outputs = []Output{{filename: "-", format: format}}
+		options.outFilename = "-"
+		if len(apiKey.Projects) > 0 {
+			options.allowedProjects = make(map[string]struct{})
+			for _, project := range apiKey.Projects {
+				options.allowedProjects[project] = struct{}{}
 			}
 		}
+		err = validateOptions(options)
 	}
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("invalid options: %v", err), http.StatusBadRequest)
+		return
+	}
+	var output bytes.Buffer
+	if err := process(inFile, []io.Writer{&output}, options); err != nil {
+		metrics.parseErrors.Add(1)
+		http.Error(writer, fmt.Sprintf("processing failed: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	metrics.rendered.Add(1)
+	cache.put(etag, output.Bytes())
+	writer.Header().Set("Content-Type", contentTypes[format])
+	_, _ = writer.Write(output.Bytes())
 }
 
-func containsKey(keys *[]string, searchKey string) bool {
-	found := false
-	for _, key := range *keys {
-		if key == searchKey {
-			found = true
-			break
-		}
+// createOutput creates the named output file, or returns stdout for "-".
+func createOutput(filename string) (*os.File, error) {
+	if filename == "-" {
+		return os.Stdout, nil
 	}
-	return found
+	return os.Create(filename)
 }
 
-func writeOutput(issues *map[string]IssueInfo, outFile *os.File, options Options) error {
-	output := bufio.NewWriter(outFile)
+func closeOutput(file *os.File) {
+	if file != os.Stdout {
+		_ = file.Close()
+	}
+}
 
-	// write header
-	_, err := output.WriteString("@startuml\n")
+// openOnServer opens the diagram in the default browser as rendered by -plantumlServer.
+func openOnServer(filename string, options Options) error {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("output failure: %v", err)
+		return fmt.Errorf("couldn't read: %v", err)
 	}
-	_, _ = output.WriteString(fmt.Sprintf("skinparam wrapWidth %d\n", options.wrapWidth))
-
-	// write each issue as an object
-	for _, issue := range *issues {
-		_, showIt := (options.showKeys)[issue.issueKey]
-		if showIt || !options.hideOrphans || len(issue.blockedKeys) > 0 || len(issue.blockerKeys) > 0 {
-			effectiveStatus := "unknown"
-			if len(issue.status) > 0 {
-				effectiveStatus = issue.status
-			}
-			_, _ = output.WriteString(fmt.Sprintf("object %s %s {\n", normalizeKey(issue.issueKey),
-				getHighlight(issue.issueKey, options)))
-			_, _ = output.WriteString(fmt.Sprintf("  %s\n", strings.ToUpper(effectiveStatus)))
-			if !options.hideSummary && len(issue.summary) > 0 {
-				_, _ = output.WriteString(fmt.Sprintf("  %s\n", issue.summary))
-			}
-			_, _ = output.WriteString("}\n")
-		}
+	encoded, err := encodePlantUml(data)
+	if err != nil {
+		return fmt.Errorf("couldn't encode: %v", err)
+	}
+	url := fmt.Sprintf("%s/svg/%s", strings.TrimSuffix(options.plantUmlServer, "/"), encoded)
+	if len(url) > 8000 {
+		logEvent(options, "warning", "long_url", map[string]any{"length": len(url)},
+			fmt.Sprintf("diagram URL is %d characters long; some servers refuse URLs that long", len(url)))
+	}
+
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		command = exec.Command("open", url)
+	default:
+		command = exec.Command("xdg-open", url)
+	}
+	return command.Start()
+}
+
+// plantUmlEncoding is base64 with PlantUML's alphabet.
+var plantUmlEncoding = base64.NewEncoding("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_").
+	WithPadding(base64.NoPadding)
+
+// encodePlantUml compresses diagram text the way PlantUML server URLs expect:
+// raw deflate, zero-padded to whole 3-byte groups, in PlantUML's base64 alphabet.
+func encodePlantUml(text []byte) (string, error) {
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	_, err = writer.Write(text)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	for compressed.Len()%3 != 0 {
+		compressed.WriteByte(0)
+	}
+	return plantUmlEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// copyToClipboard puts a file's contents on the clipboard using the platform's clipboard tool.
+func copyToClipboard(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("couldn't read: %v", err)
+	}
+
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	default:
+		candidates = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err != nil {
+			continue
+		}
+		command := exec.Command(candidate[0], candidate[1:]...)
+		command.Stdin = bytes.NewReader(data)
+		return command.Run()
+	}
+	return fmt.Errorf("no clipboard tool found (tried %v)", candidates)
+}
+
+// runImpact lists every ticket transitively blocked by the given key, by depth, and
+// diagrams them too when -out is given.
+func runImpact(options Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: impact [OPTION]... KEY")
+	}
+	key := args[0]
+
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+	if _, found := issues[key]; !found {
+		return fmt.Errorf("ticket not found: %s", key)
+	}
+
+	depths := blockedDepths(&issues, key)
+	impacted := sortedKeys(depths)
+	sort.SliceStable(impacted, func(i, j int) bool { return depths[impacted[i]] < depths[impacted[j]] })
+	// the listing moves to stderr when the diagram goes to stdout
+	var listing io.Writer = os.Stdout
+	if options.outSet && options.outFilename == "-" {
+		listing = os.Stderr
+	}
+	_, _ = fmt.Fprintf(listing, "%s transitively blocks %d tickets\n", key, len(impacted))
+	for _, impactedKey := range impacted {
+		issue := issues[impactedKey]
+		_, _ = fmt.Fprintf(listing, "  %d %s %s %s\n", depths[impactedKey], impactedKey,
+			strings.ToUpper(effectiveStatus(&issue)), issue.summary)
+	}
+
+	if options.outSet {
+		depths[key] = 0
+		keepIssues(&issues, keysOf(depths))
+		options.inputHashes = hashInputs(options)
+		for _, output := range options.outputs {
+			outFile, err := createOutput(output.filename)
+			if err != nil {
+				return fmt.Errorf("can't create output file (%s): %v", output.filename, err)
+			}
+			err = writeOutputFile(&issues, outFile, output, options)
+			closeOutput(outFile)
+			if err != nil {
+				return fmt.Errorf("output failure (%s): %v", output.filename, err)
+			}
+		}
+	}
+
+	return writeReport(&report, options)
+}
+
+// runRank prints open tickets in order of their blocking score (see blockingScore).
+func runRank(options Options) error {
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+
+	scores := make(map[string]float64)
+	for key, issue := range issues {
+		if score := blockingScore(&issues, key, options); score > 0 && !isDone(&issue, options) {
+			scores[key] = score
+		}
+	}
+	ranked := sortedKeys(scores)
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i]] > scores[ranked[j]] })
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(table, "RANK\tKEY\tSCORE\tDIRECT\tTRANSITIVE\tSTATUS\tSUMMARY")
+	for i, key := range ranked {
+		issue := issues[key]
+		direct, transitive := openDependents(&issues, key, options)
+		_, _ = fmt.Fprintf(table, "%d\t%s\t%.1f\t%d\t%d\t%s\t%s\n", i+1, key, scores[key], direct, transitive,
+			strings.ToUpper(effectiveStatus(&issue)), issue.summary)
+	}
+	err = table.Flush()
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	return writeReport(&report, options)
+}
+
+// runPath prints the shortest chain of tickets by which the first key blocks the
+// second, exiting with 2 when there's none.
+func runPath(options Options, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: path [OPTION]... FROM TO")
+	}
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+	for _, key := range args {
+		if _, found := issues[key]; !found {
+			return fmt.Errorf("ticket not found: %s", key)
+		}
+	}
+
+	path := shortestPath(&issues, args[0], args[1])
+	if err := writeReport(&report, options); err != nil {
+		return err
+	}
+	if path == nil {
+		return &exitError{code: 2, message: fmt.Sprintf("%s doesn't block %s", args[0], args[1])}
+	}
+	fmt.Println(strings.Join(path, " -> "))
+	return nil
+}
+
+// runReady tells whether every ticket transitively blocking the given keys, or the -roots
+// tickets without any, is done, listing the open ones by project and assignee.
+func runReady(options Options, args []string) error {
+	targets := args
+	if len(targets) == 0 {
+		targets = sortedKeys(options.roots)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("usage: ready [OPTION]... KEY... (or -roots)")
+	}
+	if len(options.hideKeys) > 0 {
+		// hidden tickets are dropped while reading, so an open one would pass unseen
+		return fmt.Errorf("ready can't be combined with hideKeys, whose tickets it wouldn't see")
+	}
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+	for _, key := range targets {
+		if _, found := issues[key]; !found {
+			return fmt.Errorf("ticket not found: %s", key)
+		}
+	}
+
+	blockers, open := openBlockers(&issues, targets, options)
+	if err := writeReport(&report, options); err != nil {
+		return err
+	}
+	if len(open) == 0 {
+		fmt.Printf("READY: all %d blockers of %s are done\n", len(blockers), strings.Join(targets, ", "))
+		return nil
+	}
+	fmt.Printf("NOT READY: %d of %d blockers of %s are open\n", len(open), len(blockers), strings.Join(targets, ", "))
+
+	groups := make(map[string]map[string][]string)
+	for _, key := range open {
+		project := projectKey(key)
+		assignee := issues[key].assignee
+		if len(assignee) == 0 {
+			assignee = "unassigned"
+		}
+		if groups[project] == nil {
+			groups[project] = make(map[string][]string)
+		}
+		groups[project][assignee] = append(groups[project][assignee], key)
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, project := range sortedKeys(groups) {
+		_, _ = fmt.Fprintf(table, "\n%s\n", project)
+		for _, assignee := range sortedKeys(groups[project]) {
+			_, _ = fmt.Fprintf(table, "  %s\n", assignee)
+			for _, key := range groups[project][assignee] {
+				issue := issues[key]
+				_, _ = fmt.Fprintf(table, "    %s\t%s\t%s\n", key, strings.ToUpper(effectiveStatus(&issue)), issue.summary)
+			}
+		}
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+	return nil
+}
+
+// runDetail writes a PlantUML @startjson card of one ticket's fields and direct links, to stdout
+// or -out when given.
+func runDetail(options Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: detail [OPTION]... KEY")
+	}
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+	issue, found := issues[args[0]]
+	if !found {
+		return fmt.Errorf("ticket not found: %s", args[0])
+	}
+	if err := writeReport(&report, options); err != nil {
+		return err
+	}
+
+	detail := struct {
+		jsonTicket
+		Id       string     `json:"id,omitempty"`
+		Subtasks []string   `json:"subtasks,omitempty"`
+		Links    []jsonLink `json:"links,omitempty"`
+	}{
+		jsonTicket: newJsonTicket(args[0], &issue, options),
+		Id:         issue.issueId,
+		Subtasks:   issue.subtasks,
+	}
+	for _, link := range issue.links {
+		detail.Links = append(detail.Links, jsonLink{Type: link.linkType, From: link.from, To: link.to})
+	}
+	data, err := json.MarshalIndent(detail, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode: %v", err)
+	}
+
+	outFile := os.Stdout
+	if options.outSet {
+		outFile, err = createOutput(options.outFilename)
+		if err != nil {
+			return fmt.Errorf("can't create output file (%s): %v", options.outFilename, err)
+		}
+		defer closeOutput(outFile)
+	}
+	_, err = fmt.Fprintf(outFile, "@startjson\n%s\n@endjson\n", data)
+	return err
+}
+
+// runPaths prints every chain, up to -maxDepth links long, by which the first key
+// blocks the second, exiting with 2 when there's none.
+func runPaths(options Options, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: paths [OPTION]... FROM TO")
+	}
+	var report Report
+	issues, err := readInput(&options, &report)
+	if err != nil {
+		return err
+	}
+	for _, key := range args {
+		if _, found := issues[key]; !found {
+			return fmt.Errorf("ticket not found: %s", key)
+		}
+	}
+
+	paths := allPaths(&issues, args[0], args[1], options.maxDepth)
+	if err := writeReport(&report, options); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return &exitError{code: 2, message: fmt.Sprintf("%s doesn't block %s within %d links", args[0], args[1],
+			options.maxDepth)}
+	}
+	for _, path := range paths {
+		fmt.Println(strings.Join(path, " -> "))
+	}
+	fmt.Printf("%d paths\n", len(paths))
+	return nil
+}
+
+// runInit inspects the -in sample, asks a few questions on stdin and writes a
+// starter config file to -config (jirad.json by default).
+func runInit(options Options) error {
+	configFilename := options.configFilename
+	if len(configFilename) == 0 {
+		configFilename = "jirad.json"
+	}
+	answers := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(configFilename); err == nil {
+		if !askYesNo(answers, fmt.Sprintf("%s exists. Overwrite it?", configFilename), false) {
+			return nil
+		}
+	}
+
+	inFile, err := os.Open(options.inFilename)
+	if err != nil {
+		return fmt.Errorf("can't read input file (%s): %v", options.inFilename, err)
+	}
+	options.verbose = true
+	input, err := openRecords(inFile, options)
+	var columns []string
+	if err == nil {
+		columns, err = input.Read()
+	}
+	_ = inFile.Close()
+	if err != nil {
+		return fmt.Errorf("can't inspect input file (%s): %v", options.inFilename, err)
+	}
+
+	// show what the columns mean to JiraD
+	config := options.config
+	headerFields := headerFieldsFor(options)
+	found := make(map[string]bool)
+	linkTypes := make(map[string]struct{})
+	fmt.Printf("%s has %d columns:\n", options.inFilename, len(columns))
+	for _, col := range columns {
+		col = strings.TrimSpace(col)
+		field, known := headerFields[col]
+		if known {
+			found[field] = true
+			fmt.Printf("  %s -> %s\n", col, field)
+		} else {
+			fmt.Printf("  %s (not used)\n", col)
+		}
+		for _, direction := range []string{"Inward", "Outward"} {
+			if linkType, isLink := strings.CutPrefix(col, direction+" issue link ("); isLink {
+				linkTypes[strings.TrimSuffix(linkType, ")")] = struct{}{}
+			}
+		}
+	}
+	if len(linkTypes) > 0 {
+		fmt.Printf("link types: %s\n", strings.Join(sortedKeys(linkTypes), ", "))
+	}
+
+	// ask about anything missing, then the usual choices
+	if config.Headers == nil {
+		config.Headers = make(map[string][]string)
+	}
+	for _, question := range []struct{ field, text string }{
+		{fieldIssueKey, "Which column holds the issue key?"},
+		{fieldBlocker, "Which column lists the tickets blocking each ticket? (blank for none)"},
+		{fieldBlocked, "Which column lists the tickets each ticket blocks? (blank for none)"},
+	} {
+		if !found[question.field] {
+			if col := ask(answers, question.text, ""); len(col) > 0 {
+				config.Headers[question.field] = append(config.Headers[question.field], col)
+			}
+		}
+	}
+	if len(config.Headers) == 0 {
+		config.Headers = nil
+	}
+	profileName := ask(answers, "Name for a profile using this input?", "default")
+	profile := map[string]any{
+		"in":          options.inFilename,
+		"out":         ask(answers, "Output file?", strings.TrimSuffix(options.inFilename, ".csv")+".txt"),
+		"hideOrphans": askYesNo(answers, "Hide tickets without relationships?", true),
+		"hideSummary": askYesNo(answers, "Hide ticket summaries?", false),
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]map[string]any)
+	}
+	config.Profiles[profileName] = profile
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't encode config: %v", err)
+	}
+	err = os.WriteFile(configFilename, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("can't write config file (%s): %v", configFilename, err)
+	}
+	fmt.Printf("wrote %s; run with: -config %s -profile %s\n", configFilename, configFilename, profileName)
+	return nil
+}
+
+func ask(answers *bufio.Reader, question string, defaultAnswer string) string {
+	if len(defaultAnswer) > 0 {
+		fmt.Printf("%s [%s] ", question, defaultAnswer)
+	} else {
+		fmt.Printf("%s ", question)
+	}
+	answer, _ := answers.ReadString('\n')
+	if answer = strings.TrimSpace(answer); len(answer) > 0 {
+		return answer
+	}
+	return defaultAnswer
+}
+
+func askYesNo(answers *bufio.Reader, question string, defaultAnswer bool) bool {
+	choices := "y/N"
+	if defaultAnswer {
+		choices = "Y/n"
+	}
+	switch strings.ToLower(ask(answers, question+" ("+choices+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return defaultAnswer
+}
+
+func loadOptions(args []string) (Options, error) {
+	return parseOptions(flag.CommandLine, args, nil)
+}
+
+// parseOptions reads options from args into flags, then sets the overrides (as the serve command's
+// requests give them) on top, before any -profile fills in the rest.
+func parseOptions(flags *flag.FlagSet, args []string, overrides map[string]any) (Options, error) {
+	inFilename := flags.String("in", "tickets.csv", "the file to process")
+	var outFilenames, formats stringList
+	flags.Var(&outFilenames, "out", "the file to create, or - for stdout (repeatable; default tickets.txt)")
+	reproducible := flags.Bool("reproducible", false, "leave the timestamp out, so identical inputs give identical outputs")
+	compress := flags.Bool("compress", false, "gzip every output (outputs named .gz always are)")
+	flags.Var(&formats, "format", "output format (plantuml, json, dot, mermaid, svg, embed), one per -out or one for all; "+
+		"by default from the -out extension")
+	supplementalFilename := flags.String("supplemental", "", "supplemental file to process")
+	hideSummary := flags.Bool("hideSummary", false, "don't show ticket summaries")
+	hideOrphans := flags.Bool("hideOrphans", true, "don't show tickets without relationships")
+	hideKeys := flags.String("hideKeys", "", "don't show these tickets (comma delimited, @file for a key file)")
+	showKeys := flags.String("showKeys", "", "always show these tickets (comma delimited, @file for a key file)")
+	highlightKeys := flags.String("highlightKeys", "", "highlight these tickets (comma delimited, KEY=color for a color of its own, @file for a key file)")
+	highlightColor := flags.String("highlightColor", "paleGreen", "color for highlightKeys")
+	highlightAssignee := flags.String("highlightAssignee", "", "color tickets assigned to these people (comma delimited person:color)")
+	highlightLabel := flags.String("highlightLabel", "", "color tickets carrying these labels (comma delimited label:color)")
+	highlightNew := flags.Bool("highlightNew", false, "highlight tickets and links missing from the previous run's -stateFile")
+	linkTypes := flags.String("linkTypes", "", "also draw links of these types, like Relates (comma delimited)")
+	groupByParent := flags.Bool("groupByParent", false, "draw tickets inside a package for their parent (epic)")
+	groupByTeam := flags.Bool("groupByTeam", false, "draw tickets inside a package for their team")
+	teams := flags.String("teams", "", "only show the tickets of these teams (comma delimited)")
+	parentLinks := flags.Bool("parentLinks", false, "draw a link from each parent (epic or story) to its children")
+	mergeDuplicates := flags.Bool("mergeDuplicates", false, "fold tickets linked as duplicates into one")
+	edgeColorByBlocker := flags.Bool("edgeColorByBlockerStatus", false, "draw links from done blockers gray and from open ones bold red")
+	linkCounts := flags.Bool("linkCounts", false, "label links the input recorded more than once with their count")
+	sizeByPoints := flags.Bool("sizeByPoints", false, "mark tickets with a size stereotype (XS to XL) by story points")
+	notifyUrl := flags.String("notify", "", "webhook URL (Slack or Teams) told of blocking links and cycles new since the -stateFile run")
+	stateFilename := flags.String("stateFile", "", "file recording this run's tickets and links, for -highlightNew")
+	wrapWidth := flags.Int("wrapWidth", 150, "Point at which to start wrapping text")
+	aliasStyle := flags.String("aliasStyle", "strip", "how keys become PlantUML names: strip (ABC-1 is ABC1), underscore (ABC_1)")
+	layout := flags.String("layout", "", "arrangement of the tickets (sprints, statusLanes)")
+	rankBy := flags.String("rankBy", "", "order tickets top to bottom with hidden edges (due, priority)")
+	maxNodes := flags.Int("maxNodes", 0, "split plantuml, svg and embed outputs showing more tickets into pages, NAME-pageN.EXT, with NAME.EXT an index")
+	annotateEpicDeps := flags.Bool("annotateEpicDeps", false, "also write an epic-level diagram of each output, named NAME-epics.EXT")
+	rollup := flags.String("rollup", "", "roll tickets up into a dependency diagram by this grouping (team, parent)")
+	teamField := flags.String("teamField", "Team", "column holding each ticket's team")
+	blockerColumns := flags.String("blockerColumns", "", "extra columns listing each ticket's blockers (comma delimited header names)")
+	blockedColumns := flags.String("blockedColumns", "", "extra columns listing the tickets each ticket blocks (comma delimited header names)")
+	teamMapFilename := flags.String("teamMap", "", "file mapping project keys to teams (PROJECT=Team per line)")
+	listen := flags.String("listen", "localhost:8080", "address the serve command listens on")
+	maxUpload := flags.String("maxUpload", "100MB", "largest POST /graphs request the serve command accepts (e.g. 10MB, 1GB)")
+	logFormat := flags.String("logFormat", "text", "diagnostics format on stderr: text, or json for one event object per line")
+	var sitePrefixes stringList
+	flags.Var(&sitePrefixes, "sitePrefix", "prefix for the keys of an input's Jira site, once for -in then for -supplemental")
+	appendFilename := flags.String("append", "", "file accumulating the tickets of successive runs, read and rewritten by each")
+	aliasesFilename := flags.String("aliases", "", "file mapping old keys of moved tickets to current ones (OLD-1=NEW-1 per line)")
+	lang := flags.String("lang", "", "export language of the input headers (en, de, fr, es, pt, ja); all when empty")
+	configFilename := flags.String("config", "", "JSON configuration file")
+	verbose := flags.Bool("verbose", false, "report processing details")
+	quiet := flags.Bool("quiet", false, "replace the warnings with a one-line summary, for cron jobs")
+	errorFilename := flags.String("errorFile", "", "file to receive malformed input rows")
+	strictDuplicates := flags.Bool("strictDuplicates", false, "fail when duplicate rows for a ticket conflict")
+	roots := flags.String("roots", "", "only show these tickets and what transitively blocks them (comma delimited, @file for a key file)")
+	failIfBlocked := flags.String("failIfBlocked", "", "exit with 3 when these tickets have open transitive blockers (comma delimited, @file for a key file)")
+	failOnCycle := flags.Bool("failOnCycle", false, "exit with 4 after listing the cycles when blocking links form any")
+	autoPrune := flags.Bool("autoPrune", false, "drop done tickets, and the config's low-value ones, that block nothing shown")
+	endpointsOnly := flags.Bool("endpointsOnly", false, "only show tickets that block nothing or that nothing blocks")
+	showImpact := flags.Bool("showImpact", false, "show how many open tickets transitively depend on each ticket")
+	showSlack := flags.Bool("showSlack", false, "show the days each ticket can slip before a due date downstream is missed")
+	showAge := flags.Bool("showAge", false, "show how long ago each ticket was created")
+	ageColors := flags.String("ageColors", "90:Khaki", "colors of open tickets older than some days, for -showAge (comma delimited days:color)")
+	readBuffer := flags.String("readBuffer", "1MB", "size of the input read buffer (e.g. 64KB, 16MB)")
+	staleAfter := flags.String("staleAfter", "", "mark open blockers not updated for longer than this (e.g. 21d or 3w)")
+	daysPerPoint := flags.Float64("daysPerPoint", 1, "days of work per story point, for -showSlack")
+	doneStatuses := flags.String("doneStatuses", "Done,Closed,Resolved", "statuses of finished tickets (comma delimited)")
+	metrics := flags.String("metrics", "", "centrality metric to compute (pagerank, betweenness)")
+	metricsShading := flags.Bool("metricsShading", false, "shade tickets by their -metrics score")
+	keysFilename := flags.String("keysFile", "", "only show the tickets listed in this file (one per line)")
+	keysNeighbors := flags.Bool("keysNeighbors", false, "also show tickets directly linked to those in -keysFile")
+	maxDepth := flags.Int("maxDepth", 10, "longest chain, in links, the paths command follows")
+	clipboard := flags.Bool("clipboard", false, "also copy the output to the clipboard")
+	open := flags.Bool("open", false, "open the diagram, rendered by -plantumlServer, in the default browser")
+	plantUmlServer := flags.String("plantumlServer", "https://www.plantuml.com/plantuml", "PlantUML server for -open and the svg and embed formats")
+	theme := flags.String("theme", "", "PlantUML theme name or URL")
+	var skinparams stringList
+	flags.Var(&skinparams, "skinparam", "PlantUML skinparam to emit, e.g. \"shadowing false\" (repeatable)")
+	var together stringList
+	flags.Var(&together, "together", "tickets to keep adjacent in the layout (comma delimited, repeatable)")
+	includeFilename := flags.String("include", "", "file whose contents go at the top of the diagram")
+	epilogueFilename := flags.String("epilogue", "", "file whose contents go at the bottom of the diagram")
+	paletteName := flags.String("palette", "", "color palette: from -config, or built-in (light, dark, colorblind)")
+	profile := flags.String("profile", "", "name of the -config profile to apply")
+	var arguments []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return Options{}, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		arguments = append(arguments, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if err := setOptions(flags, overrides, nil); err != nil {
+		return Options{}, err
+	}
+
+	config, err := loadConfig(*configFilename)
+	if err != nil {
+		return Options{}, fmt.Errorf("config failure (%s): %v", *configFilename, err)
+	}
+	if len(*profile) > 0 {
+		if err := applyProfile(flags, config, *profile); err != nil {
+			return Options{}, fmt.Errorf("profile failure (%s): %v", *profile, err)
+		}
+	}
+
+	var options Options
+	options.config = config
+	options.arguments = arguments
+	options.inFilename = *inFilename
+	if len(outFilenames) == 0 {
+		outFilenames = stringList{"tickets.txt"}
+	}
+	if len(formats) > 1 && len(formats) != len(outFilenames) {
+		return options, fmt.Errorf("%d formats for %d outputs", len(formats), len(outFilenames))
+	}
+	for i, filename := range outFilenames {
+		output := Output{filename: filename, format: "plantuml", compress: *compress}
+		name := strings.ToLower(filename)
+		if strings.HasSuffix(name, ".gz") {
+			output.compress = true
+			name = strings.TrimSuffix(name, ".gz")
+		}
+		if format, found := formatExtensions[filepath.Ext(name)]; found {
+			output.format = format
+		}
+		if len(formats) == 1 {
+			output.format = formats[0]
+		} else if len(formats) > 1 {
+			output.format = formats[i]
+		}
+		options.outputs = append(options.outputs, output)
+	}
+	options.outFilename = options.outputs[0].filename
+	options.supplementalFilename = *supplementalFilename
+	options.hideSummary = *hideSummary
+	options.hideOrphans = *hideOrphans
+	options.hideKeys = parseKeys(*hideKeys)
+	options.showKeys = parseKeys(*showKeys)
+	options.highlightKeys = parseKeys(*highlightKeys)
+	options.highlightColor = *highlightColor
+	options.highlightAssignees = parseColors(*highlightAssignee)
+	options.highlightLabels = parseColors(*highlightLabel)
+	options.highlightNew = *highlightNew
+	options.sizeByPoints = *sizeByPoints
+	options.linkCounts = *linkCounts
+	options.edgeColorByBlocker = *edgeColorByBlocker
+	options.linkTypes = parseKeys(strings.ToLower(*linkTypes))
+	options.mergeDuplicates = *mergeDuplicates
+	options.groupByParent = *groupByParent
+	options.groupByTeam = *groupByTeam
+	options.teams = parseKeys(strings.ToUpper(*teams))
+	options.parentLinks = *parentLinks
+	options.stateFilename = *stateFilename
+	options.wrapWidth = *wrapWidth
+	options.rollup = *rollup
+	options.layout = *layout
+	options.maxNodes = *maxNodes
+	options.aliasStyle = *aliasStyle
+	options.rankBy = *rankBy
+	options.annotateEpicDeps = *annotateEpicDeps
+	options.teamField = *teamField
+	options.blockerColumns = parseColumns(*blockerColumns)
+	options.blockedColumns = parseColumns(*blockedColumns)
+	options.teamMapFilename = *teamMapFilename
+	options.aliasesFilename = *aliasesFilename
+	options.appendFilename = *appendFilename
+	options.sitePrefixes = sitePrefixes
+	options.logFormat = *logFormat
+	options.listen = *listen
+	options.notifyUrl = *notifyUrl
+	options.lang = *lang
+	options.configFilename = *configFilename
+	options.verbose = *verbose
+	options.quiet = *quiet
+	options.errorFilename = *errorFilename
+	options.strictDuplicates = *strictDuplicates
+	options.roots = parseKeys(*roots)
+	options.failIfBlocked = parseKeys(*failIfBlocked)
+	options.failOnCycle = *failOnCycle
+	options.endpointsOnly = *endpointsOnly
+	options.autoPrune = *autoPrune
+	options.showImpact = *showImpact
+	options.showSlack = *showSlack
+	options.showAge = *showAge
+	options.readBuffer, err = parseSize(*readBuffer)
+	if err != nil {
+		return options, fmt.Errorf("readBuffer: %v", err)
+	}
+	options.maxUpload, err = parseSize(*maxUpload)
+	if err != nil {
+		return options, fmt.Errorf("maxUpload: %v", err)
+	}
+	if len(*staleAfter) > 0 {
+		options.staleAfter, err = parseDays(*staleAfter)
+		if err != nil {
+			return options, fmt.Errorf("staleAfter: %v", err)
+		}
+	}
+	options.ageColors = make(map[int]string)
+	for days, color := range parseColors(*ageColors) {
+		threshold, err := strconv.Atoi(days)
+		if err != nil || len(color) == 0 {
+			return options, fmt.Errorf("ageColors entries must be days:color, not '%s:%s'", days, color)
+		}
+		options.ageColors[threshold] = color
+	}
+	options.daysPerPoint = *daysPerPoint
+	options.doneStatuses = parseKeys(strings.ToUpper(*doneStatuses))
+	options.metrics = *metrics
+	options.metricsShading = *metricsShading
+	options.maxDepth = *maxDepth
+	options.keysFilename = *keysFilename
+	options.keysNeighbors = *keysNeighbors
+	options.reproducible = *reproducible
+	options.now = time.Now()
+	options.clipboard = *clipboard
+	options.open = *open
+	options.plantUmlServer = *plantUmlServer
+	options.theme = *theme
+	options.skinparams = skinparams
+	for _, keys := range together {
+		options.together = append(options.together, parseKeys(keys))
+	}
+	options.includeFilename = *includeFilename
+	options.epilogueFilename = *epilogueFilename
+	if len(*paletteName) > 0 {
+		palette, found := config.Palettes[*paletteName]
+		if !found {
+			palette, found = palettes[*paletteName]
+		}
+		if !found {
+			return options, fmt.Errorf("unknown palette '%s'", *paletteName)
+		}
+		options.palette = palette
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "out":
+			options.outSet = true
+		case "highlightColor":
+			options.highlightColorSet = true
+		case "plantumlServer":
+			options.plantUmlServerSet = true
+		}
+		if f.Name == "notify" {
+			// webhook URLs carry their credentials, and diagrams end up on wikis
+			options.settings = append(options.settings, "-notify=redacted")
+		} else if f.Name != "in" && f.Name != "supplemental" {
+			options.settings = append(options.settings, flagSettings(f)...)
+		}
+	})
+	if len(options.palette.Highlight) > 0 && !options.highlightColorSet {
+		options.highlightColor = options.palette.Highlight
+	}
+
+	for _, keys := range []map[string]struct{}{options.hideKeys, options.showKeys, options.highlightKeys, options.roots, options.failIfBlocked} {
+		if err := expandKeyFiles(keys); err != nil {
+			return options, err
+		}
+	}
+	options.highlightKeyColors = make(map[string]string)
+	for entry := range options.highlightKeys {
+		if key, color, colored := strings.Cut(entry, "="); colored {
+			delete(options.highlightKeys, entry)
+			options.highlightKeys[strings.TrimSpace(key)] = struct{}{}
+			options.highlightKeyColors[strings.TrimSpace(key)] = strings.TrimSpace(color)
+		}
+	}
+	fileKeys, err := loadKeyFile(options.keysFilename)
+	if err != nil {
+		return options, fmt.Errorf("keys file failure (%s): %v", options.keysFilename, err)
+	}
+	options.fileKeys = fileKeys
+	options.teamMap, err = loadMapFile(options.teamMapFilename, "PROJECT=Team")
+	if err != nil {
+		return options, fmt.Errorf("team map failure: %v", err)
+	}
+	if _, err := os.Stat(options.stateFilename); len(options.stateFilename) > 0 && err == nil {
+		previousState, err := loadKeyFile(options.stateFilename)
+		if err != nil {
+			return options, fmt.Errorf("state file failure (%s): %v", options.stateFilename, err)
+		}
+		options.previousState = previousState
+	}
+
+	return options, nil
+}
+
+// flagSettings returns a set flag as it would be given on the command line, once per value of repeatable ones.
+func flagSettings(f *flag.Flag) []string {
+	values := []string{f.Value.String()}
+	if list, isList := f.Value.(*stringList); isList {
+		values = *list
+	}
+	var settings []string
+	for _, value := range values {
+		if strings.ContainsAny(value, " \t\"'") || len(value) == 0 {
+			value = strconv.Quote(value)
+		}
+		settings = append(settings, fmt.Sprintf("-%s=%s", f.Name, value))
+	}
+	return settings
+}
+
+// applyProfile sets each option the named profile holds, unless it was given on the command line.
+func applyProfile(flags *flag.FlagSet, config Config, name string) error {
+	profile, found := config.Profiles[name]
+	if !found {
+		return fmt.Errorf("not in config")
+	}
+	explicit := make(map[string]struct{})
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = struct{}{}
+	})
+	for _, option := range sortedKeys(profile) {
+		if option == "profile" || option == "config" {
+			return fmt.Errorf("profiles can't set '%s'", option)
+		}
+	}
+	return setOptions(flags, profile, explicit)
+}
+
+// setOptions sets each option in values, as JSON decodes them, except those in skip. Lists
+// set repeatable options once per item and others to the comma delimited items.
+func setOptions(flags *flag.FlagSet, values map[string]any, skip map[string]struct{}) error {
+	for _, option := range sortedKeys(values) {
+		if _, skipped := skip[option]; skipped {
+			continue
+		}
+		if list, isList := values[option].([]any); isList && isRepeatable(flags, option) {
+			for _, item := range list {
+				if err := flags.Set(option, fmt.Sprint(item)); err != nil {
+					return fmt.Errorf("option '%s': %v", option, err)
+				}
+			}
+			continue
+		}
+		value := fmt.Sprint(values[option])
+		if list, isList := values[option].([]any); isList {
+			var items []string
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			value = strings.Join(items, ",")
+		}
+		if err := flags.Set(option, value); err != nil {
+			return fmt.Errorf("option '%s': %v", option, err)
+		}
+	}
+	return nil
+}
+
+// loadKeyFile reads one key per line. Blank lines and anything after '#' are ignored.
+func loadKeyFile(filename string) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	if len(filename) == 0 {
+		return keys, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return keys, fmt.Errorf("couldn't open: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	err = readLines(file, func(line string) error {
+		line, _, _ = strings.Cut(line, "#")
+		if key := strings.TrimSpace(line); len(key) > 0 {
+			keys[key] = struct{}{}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// readLines calls visit with each line, without its line end. Unlike a Scanner's, lines may be any length.
+func readLines(file io.Reader, visit func(line string) error) error {
+	input := bufio.NewReader(file)
+	for {
+		line, err := input.ReadString('\n')
+		if len(line) > 0 {
+			if visitErr := visit(strings.TrimRight(line, "\r\n")); visitErr != nil {
+				return visitErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// expandKeyFiles replaces each "@filename" entry of a key list with the keys in that file.
+func expandKeyFiles(keys map[string]struct{}) error {
+	for entry := range keys {
+		if filename, isFile := strings.CutPrefix(entry, "@"); isFile {
+			fileKeys, err := loadKeyFile(filename)
+			if err != nil {
+				return fmt.Errorf("key file failure (%s): %v", filename, err)
+			}
+			delete(keys, entry)
+			for key := range fileKeys {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	return nil
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func isRepeatable(flags *flag.FlagSet, name string) bool {
+	f := flags.Lookup(name)
+	if f == nil {
+		return false
+	}
+	_, repeatable := f.Value.(*stringList)
+	return repeatable
+}
+
+func loadConfig(filename string) (Config, error) {
+	var config Config
+	if len(filename) == 0 {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return config, fmt.Errorf("couldn't read: %v", err)
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("couldn't parse: %v", err)
+	}
+	return config, nil
+}
+
+func validateOptions(options Options) error {
+	if options.logFormat != "text" && options.logFormat != "json" {
+		return fmt.Errorf("unknown logFormat '%s'", options.logFormat)
+	}
+	if options.quiet && options.verbose {
+		return fmt.Errorf("quiet and verbose can't be combined")
+	}
+	inputs := 1
+	if len(options.supplementalFilename) > 0 {
+		inputs++
+	}
+	if len(options.sitePrefixes) > inputs {
+		return fmt.Errorf("%d sitePrefix values for %d inputs", len(options.sitePrefixes), inputs)
+	}
+	for _, site := range options.sitePrefixes {
+		if len(site) == 0 || strings.ContainsAny(site, " \t\r\n,;/") {
+			return fmt.Errorf("sitePrefix '%s' must be non-empty, without spaces, separators or '/'", site)
+		}
+	}
+	switch options.rollup {
+	case "", "team", "parent":
+	default:
+		return fmt.Errorf("unknown rollup '%s'", options.rollup)
+	}
+	if options.annotateEpicDeps && len(options.rollup) > 0 {
+		return fmt.Errorf("annotateEpicDeps can't be combined with rollup")
+	}
+	if options.maxNodes < 0 {
+		return fmt.Errorf("maxNodes must not be negative")
+	}
+	if len(options.failIfBlocked) > 0 && len(options.hideKeys) > 0 {
+		return fmt.Errorf("failIfBlocked can't be combined with hideKeys, whose tickets it wouldn't see")
+	}
+	if options.readBuffer > maxReadBuffer {
+		return fmt.Errorf("readBuffer must be at most %d MB", maxReadBuffer>>20)
+	}
+	if options.maxNodes > 0 && len(options.rollup) > 0 {
+		return fmt.Errorf("maxNodes can't be combined with rollup")
+	}
+	switch options.layout {
+	case "", "sprints", "statusLanes":
+	default:
+		return fmt.Errorf("unknown layout '%s'", options.layout)
+	}
+	switch options.aliasStyle {
+	case "strip", "underscore":
+	default:
+		return fmt.Errorf("unknown aliasStyle '%s'", options.aliasStyle)
+	}
+	switch options.rankBy {
+	case "", "due", "priority":
+	default:
+		return fmt.Errorf("unknown rankBy '%s'", options.rankBy)
+	}
+	if err := validateColors(options); err != nil {
+		return err
+	}
+	switch options.metrics {
+	case "", "pagerank", "betweenness":
+	default:
+		return fmt.Errorf("unknown metrics '%s'", options.metrics)
+	}
+	for _, output := range options.outputs {
+		if !containsKey(&outputFormats, output.format) {
+			return fmt.Errorf("unknown format '%s'", output.format)
+		}
+		if output.format != "plantuml" && output.format != "svg" && output.format != "embed" && len(options.rollup) > 0 {
+			return fmt.Errorf("rollup only writes plantuml, svg or embed, not %s", output.format)
+		}
+		pageable := output.format == "plantuml" || output.format == "svg" || output.format == "embed"
+		if pageable && output.filename == "-" && options.maxNodes > 0 {
+			return fmt.Errorf("maxNodes needs out files for its pages, not stdout")
+		}
+	}
+	if options.outFilename == "-" && (options.clipboard || options.open) {
+		return fmt.Errorf("clipboard and open need an out file, not stdout")
+	}
+	if options.outputs[0].compress && (options.clipboard || options.open) {
+		return fmt.Errorf("clipboard and open need an uncompressed out file")
+	}
+	if len(options.notifyUrl) > 0 && len(options.stateFilename) == 0 {
+		return fmt.Errorf("notify needs a stateFile")
+	}
+	if options.highlightNew && len(options.stateFilename) == 0 {
+		return fmt.Errorf("highlightNew needs a stateFile")
+	}
+	if _, found := headerAliases[options.lang]; len(options.lang) > 0 && !found {
+		return fmt.Errorf("unknown lang '%s'", options.lang)
+	}
+	for field := range options.config.Headers {
+		if _, known := headerAliases["en"][field]; !known && field != fieldTeam {
+			return fmt.Errorf("unknown header field '%s' in config", field)
+		}
+	}
+	return nil
+}
+
+func process(inFile *os.File, outFiles []io.Writer, options Options) error {
+	var report Report
+	issues, err := readAllIssues(inFile, options, &report)
+	if err != nil {
+		return err
+	}
+	options.now = inputNow(&issues, options)
+
+	if options.mergeDuplicates {
+		mergeDuplicates(&issues)
+	}
+	blocked, err := checkBlocked(&issues, options)
+	if err != nil {
+		return err
+	}
+	var cycles []string
+	if options.failOnCycle {
+		cycles = findCycles(&issues)
+	}
+	if len(report.hiddenKeys) > 0 {
+		report.filtered = append(report.filtered, FilterCount{rule: "hideKeys", tickets: len(report.hiddenKeys)})
+	}
+	count := len(issues)
+	applyProjectHides(&issues, options)
+	count = report.addFiltered("project config", count, &issues)
+	applyTeams(&issues, options)
+	count = report.addFiltered("teams", count, &issues)
+	applyAllowedProjects(&issues, options)
+	count = report.addFiltered("API key projects", count, &issues)
+	if options.autoPrune {
+		applyAutoPrune(&issues, options)
+		count = report.addFiltered("autoPrune", count, &issues)
+	}
+	if options.showImpact {
+		computeImpact(&issues, options)
+	}
+	if options.showSlack {
+		computeSlack(&issues, options)
+	}
+	if len(options.metrics) > 0 {
+		computeCentrality(&issues, options)
+		report.centrality = make(map[string]float64)
+		for key, issue := range issues {
+			report.centrality[key] = issue.centrality
+		}
+	}
+	applyRoots(&issues, options)
+	count = report.addFiltered("roots", count, &issues)
+	applyKeysFile(&issues, options)
+	count = report.addFiltered("keysFile", count, &issues)
+	if options.endpointsOnly {
+		applyEndpointsOnly(&issues)
+		report.addFiltered("endpointsOnly", count, &issues)
+	}
+	if hidden := len(issues) - len(shownIssues(&issues, options)); hidden > 0 {
+		report.filtered = append(report.filtered, FilterCount{rule: "hideOrphans", tickets: hidden})
+	}
+
+	err = writeOutputs(&issues, outFiles, options)
+	if err != nil {
+		return err
+	}
+	if options.annotateEpicDeps {
+		err = writeEpicOutputs(&issues, options)
+		if err != nil {
+			return err
+		}
+	}
+	if len(options.stateFilename) > 0 {
+		err = writeState(&issues, options.stateFilename)
+		if err != nil {
+			return fmt.Errorf("state file failure (%s): %v", options.stateFilename, err)
+		}
+	}
+	if len(options.notifyUrl) > 0 {
+		err = notifyChanges(&issues, options)
+		if err != nil {
+			return fmt.Errorf("notify failure: %v", err)
+		}
+	}
+
+	err = writeReport(&report, options)
+	if err != nil {
+		return fmt.Errorf("report failure: %v", err)
+	}
+
+	for _, cycle := range cycles {
+		logEvent(options, "error", "cycle", map[string]any{"cycle": cycle}, "cycle: "+cycle)
+	}
+	if len(cycles) > 0 {
+		return &exitError{code: 4, message: fmt.Sprintf("found %d blocking cycles", len(cycles))}
+	}
+	if len(blocked) > 0 {
+		return &exitError{code: 3, message: fmt.Sprintf("%s blocked by %d open tickets: %s",
+			strings.Join(sortedKeys(options.failIfBlocked), ", "), len(blocked), strings.Join(blocked, ", "))}
+	}
+	return nil
+}
+
+// checkBlocked returns the open tickets transitively blocking the -failIfBlocked tickets, so
+// release pipelines can gate on them. Tickets hidden after reading, e.g. by -hideOrphans, still
+// count; -hideKeys drops its tickets while reading, so validateOptions refuses it alongside.
+func checkBlocked(issues *map[string]IssueInfo, options Options) ([]string, error) {
+	if len(options.failIfBlocked) == 0 {
+		return nil, nil
+	}
+	targets := sortedKeys(options.failIfBlocked)
+	for _, key := range targets {
+		if _, found := (*issues)[key]; !found {
+			return nil, fmt.Errorf("ticket not found: %s", key)
+		}
+	}
+	_, open := openBlockers(issues, targets, options)
+	return open, nil
+}
+
+// readAllIssues reads the supplemental and input files into a cross-linked set of issues.
+func readAllIssues(inFile *os.File, options Options, report *Report) (map[string]IssueInfo, error) {
+	issues := make(map[string]IssueInfo)
+
+	err := processSupplementalFile(options, &issues, report)
+	if err != nil {
+		logEvent(options, "warning", "supplemental_failed", map[string]any{"message": err.Error()},
+			fmt.Sprintf("Problem processing supplemental: %v. Continuing.", err))
+	}
+
+	err = processFile(inFile, inFile.Name(), inputSite(options, 0), options, &issues, report)
+	if err != nil {
+		return issues, fmt.Errorf("input failure: %v", err)
+	}
+	if conflicts := report.conflictCount(); options.strictDuplicates && conflicts > 0 {
+		_ = writeReport(report, options)
+		return issues, fmt.Errorf("input failure: %d issue keys have conflicting duplicate rows", conflicts)
+	}
+	if len(options.appendFilename) > 0 {
+		err = appendAccumulated(&issues, options, report)
+		if err != nil {
+			return issues, fmt.Errorf("append failure (%s): %v", options.appendFilename, err)
+		}
+	}
+
+	resolveLinkIds(&issues)
+	if len(options.aliasesFilename) > 0 {
+		aliases, err := loadMapFile(options.aliasesFilename, "OLD-1=NEW-1")
+		if err != nil {
+			return issues, fmt.Errorf("aliases failure (%s): %v", options.aliasesFilename, err)
+		}
+		applyAliases(&issues, aliases, report)
+	}
+	fillDependencies(&issues, options)
+	resolveParents(&issues)
+	report.findDangling(&issues)
+	for _, key := range report.danglingKeys {
+		issue := issues[key]
+		issue.placeholder = true
+		issues[key] = issue
+	}
+	report.findContradictions(&issues)
+	return issues, nil
+}
+
+// appendAccumulated adds the tickets earlier -append runs collected that this run's inputs have no
+// rows for, then records every ticket with a row, this run's replacing earlier ones, for the next run.
+func appendAccumulated(issues *map[string]IssueInfo, options Options, report *Report) error {
+	accumulated := make(map[string]IssueInfo)
+	var previous Report
+	file, err := os.Open(options.appendFilename)
+	if err == nil {
+		// hidden tickets are only left out of this run's output, not out of the accumulated ones
+		raw := options
+		raw.hideKeys = nil
+		err = processFile(file, options.appendFilename, "", raw, &accumulated, &previous)
+		_ = file.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't read: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("couldn't open: %v", err)
+	}
+
+	stored := make(map[string]IssueInfo)
+	for key, issue := range accumulated {
+		if _, hasRow := previous.firstRows[key]; hasRow {
+			stored[key] = issue
+		}
+	}
+	for key, issue := range *issues {
+		if _, hasRow := report.firstRows[key]; hasRow {
+			stored[key] = issue
+		}
+	}
+	for _, key := range sortedKeys(stored) {
+		_, current := report.firstRows[key]
+		_, hideIt := options.hideKeys[key]
+		_, showIt := options.showKeys[key]
+		if !current && (showIt || !hideIt) {
+			issue := stored[key]
+			report.addRow(&issue)
+			(*issues)[key] = issue
+		}
+	}
+	// tickets earlier runs only saw linked stay placeholders, unless this run has them
+	for key, issue := range accumulated {
+		_, hasRow := previous.firstRows[key]
+		if _, found := (*issues)[key]; !found && !hasRow {
+			(*issues)[key] = issue
+		}
+	}
+	return writeAccumulated(&stored, options)
+}
+
+// writeAccumulated writes tickets as a CSV export with English headers, repeating the label and
+// link columns as often as the ticket with the most of them needs, so processFile reads it back.
+func writeAccumulated(issues *map[string]IssueInfo, options Options) error {
+	keys := sortedKeys(*issues)
+	var rows [][]string
+	var lists []map[string][]string
+	repeats := make(map[string]int)
+	for _, key := range keys {
+		issue := (*issues)[key]
+		points := ""
+		if issue.points != 0 {
+			points = strconv.FormatFloat(issue.points, 'f', -1, 64)
+		}
+		due, created, updated := "", "", ""
+		if !issue.due.IsZero() {
+			due = issue.due.Format(time.DateOnly)
+		}
+		if !issue.created.IsZero() {
+			created = issue.created.Format(time.DateOnly)
+		}
+		if !issue.updated.IsZero() {
+			updated = issue.updated.Format(time.DateOnly)
+		}
+		rows = append(rows, []string{key, issue.issueId, issue.summary, issue.status, issue.category, issue.issueType,
+			issue.priority, points, issue.team, issue.assignee, issue.parent, strings.Join(issue.subtasks, ","), due, created, updated, issue.description})
+		values := map[string][]string{
+			"Labels":                        issue.labels,
+			"Sprint":                        issue.sprints,
+			linkHeader("Inward", "Blocks"):  issue.blockerKeys,
+			linkHeader("Outward", "Blocks"): issue.blockedKeys,
+		}
+		for _, link := range issue.links {
+			if link.to == key {
+				values[linkHeader("Inward", link.linkType)] = append(values[linkHeader("Inward", link.linkType)], link.from)
+			} else {
+				values[linkHeader("Outward", link.linkType)] = append(values[linkHeader("Outward", link.linkType)], link.to)
+			}
+		}
+		for name, list := range values {
+			repeats[name] = max(repeats[name], len(list))
+		}
+		lists = append(lists, values)
+	}
+
+	header := []string{"Issue key", "Issue id", "Summary", "Status", "Status Category", "Issue Type", "Priority",
+		"Story Points", options.teamField, "Assignee", "Parent", "Sub-tasks", "Due Date", "Created", "Updated", "Description"}
+	for _, name := range sortedKeys(repeats) {
+		for i := 0; i < repeats[name]; i++ {
+			header = append(header, name)
+			for row := range rows {
+				value := ""
+				if i < len(lists[row][name]) {
+					value = lists[row][name][i]
+				}
+				rows[row] = append(rows[row], value)
+			}
+		}
+	}
+
+	file, err := os.Create(options.appendFilename)
+	if err != nil {
+		return fmt.Errorf("couldn't create: %v", err)
+	}
+	output := csv.NewWriter(file)
+	_ = output.Write(header)
+	_ = output.WriteAll(rows)
+	err = output.Error()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func processSupplementalFile(options Options, issues *map[string]IssueInfo, report *Report) error {
+	if len(options.supplementalFilename) > 0 {
+		supplementalFile, err := os.Open(options.supplementalFilename)
+		if err != nil {
+			return fmt.Errorf("couldn't open: %v", err)
+		}
+		err = processFile(supplementalFile, options.supplementalFilename, inputSite(options, 1), options, issues, report)
+		if err != nil {
+			return fmt.Errorf("processing problem: %v", err)
+		}
+		_ = supplementalFile.Close()
+	}
+	return nil
+}
+
+// inputSite returns the -sitePrefix of the nth input, counting -in first, or "" if it has none.
+func inputSite(options Options, n int) string {
+	if n < len(options.sitePrefixes) {
+		return options.sitePrefixes[n]
+	}
+	return ""
+}
+
+// processFile reads an input into issues, prefixing its keys with site when given.
+func processFile(file io.Reader, name string, site string, options Options, issues *map[string]IssueInfo,
+	report *Report) error {
+	input, err := openRecords(file, options)
+	if err != nil {
+		return fmt.Errorf("format failure: %v", err)
+	}
+	headerInfo, err := readHeader(input, options)
+	if err != nil {
+		return fmt.Errorf("header failure: %v", err)
+	}
+	return readIssues(input, name, site, &headerInfo, options, issues, report)
+}
+
+// recordReader yields input rows as columns, header row first.
+type recordReader interface {
+	Read() ([]string, error)
+	// Line returns the line number where the last row read began.
+	Line() int
+	// Raw returns the last row read as it appeared in the input.
+	Raw() string
+}
+
+// csvRecords reads delimited text, keeping the raw text of each row for error reporting.
+type csvRecords struct {
+	reader  *csv.Reader
+	capture *rawCapture
+	line    int
+	raw     string
+}
+
+func (c *csvRecords) Read() ([]string, error) {
+	start := c.reader.InputOffset()
+	record, err := c.reader.Read()
+	c.raw = strings.TrimRight(string(c.capture.take(start, c.reader.InputOffset())), "\r\n")
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		c.line = parseErr.StartLine
+	} else if err == nil {
+		c.line, _ = c.reader.FieldPos(0)
+	}
+	return record, err
+}
+
+func (c *csvRecords) Line() int {
+	return c.line
+}
+
+func (c *csvRecords) Raw() string {
+	return c.raw
+}
+
+// rawCapture remembers what has been read but not yet claimed by a row.
+type rawCapture struct {
+	reader io.Reader
+	buffer []byte
+	offset int64
+}
+
+func (c *rawCapture) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.buffer = append(c.buffer, p[:n]...)
+	return n, err
+}
+
+// take returns the bytes between two input offsets and forgets everything before the end.
+func (c *rawCapture) take(start int64, end int64) []byte {
+	taken := bytes.Clone(c.buffer[start-c.offset : end-c.offset])
+	c.buffer = c.buffer[end-c.offset:]
+	c.offset = end
+	return taken
+}
+
+// openRecords sniffs the input format and returns a reader of its rows.
+func openRecords(file io.Reader, options Options) (recordReader, error) {
+	// the buffer holds at least the sniffed start of the input
+	reader := bufio.NewReaderSize(file, max(options.readBuffer, 4096))
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		_, _ = reader.Discard(3)
+	}
+	peek, err := reader.Peek(4096)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("couldn't read: %v", err)
+	}
+
+	format, delimiter := sniffFormat(peek)
+	if options.verbose {
+		if delimiter != 0 {
+			logEvent(options, "info", "input_detected", map[string]any{"format": format, "delimiter": string(delimiter)},
+				fmt.Sprintf("detected %s input (delimiter %q)", format, delimiter))
+		} else {
+			logEvent(options, "info", "input_detected", map[string]any{"format": format},
+				fmt.Sprintf("detected %s input", format))
+		}
+	}
+
+	switch format {
+	case "JSON":
+		return readJsonRecords(reader)
+	case "XML":
+		return readXmlRecords(reader)
+	case "HTML":
+		return readHtmlRecords(reader)
+	}
+	capture := &rawCapture{reader: reader}
+	input := csv.NewReader(capture)
+	input.Comma = delimiter
+	input.FieldsPerRecord = -1
+	input.LazyQuotes = true
+	return &csvRecords{reader: input, capture: capture}, nil
+}
+
+// sniffFormat guesses the format from the start of the input. For delimited
+// text it picks whichever of comma, semicolon or tab is most common in the header.
+func sniffFormat(peek []byte) (string, rune) {
+	trimmed := bytes.TrimLeft(peek, " \t\r\n")
+	if len(trimmed) > 0 {
+		switch trimmed[0] {
+		case '{', '[':
+			return "JSON", 0
+		case '<':
+			lower := bytes.ToLower(trimmed)
+			if !bytes.Contains(lower, []byte("<rss")) && (bytes.Contains(lower, []byte("<html")) ||
+				bytes.Contains(lower, []byte("<table"))) {
+				return "HTML", 0
+			}
+			return "XML", 0
+		}
+	}
+
+	header, _, _ := bytes.Cut(peek, []byte("\n"))
+	counts := map[rune]int{',': 0, ';': 0, '\t': 0}
+	quoted := false
+	for _, r := range string(header) {
+		if r == '"' {
+			quoted = !quoted
+		} else if _, counted := counts[r]; counted && !quoted {
+			counts[r]++
+		}
+	}
+	delimiter := ','
+	for _, candidate := range []rune{';', '\t'} {
+		if counts[candidate] > counts[delimiter] {
+			delimiter = candidate
+		}
+	}
+	if delimiter == '\t' {
+		return "TSV", delimiter
+	}
+	return "CSV", delimiter
+}
+
+// sliceRecords replays rows converted from a structured format. Their
+// "lines" are row numbers, header included, and their raw text is CSV.
+type sliceRecords struct {
+	records [][]string
+	line    int
+}
+
+func (s *sliceRecords) Read() ([]string, error) {
+	if s.line >= len(s.records) {
+		return nil, io.EOF
+	}
+	s.line++
+	return s.records[s.line-1], nil
+}
+
+func (s *sliceRecords) Line() int {
+	return s.line
+}
+
+func (s *sliceRecords) Raw() string {
+	var raw strings.Builder
+	writer := csv.NewWriter(&raw)
+	_ = writer.Write(s.records[s.line-1])
+	writer.Flush()
+	return strings.TrimRight(raw.String(), "\n")
+}
+
+var (
+	htmlTables = regexp.MustCompile(`(?is)<table\b.*?</table>`)
+	htmlRows   = regexp.MustCompile(`(?is)<tr\b[^>]*>(.*?)</tr>`)
+	htmlCells  = regexp.MustCompile(`(?is)<t[hd]\b[^>]*>(.*?)</t[hd]>`)
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</li>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// readHtmlRecords reads an HTML page's issue table, such as a Confluence page exported with a
+// Jira issues macro or a hand-kept tracker table: the one with the most rows, the first being
+// its header. Line breaks within cells are kept, so cells can list several keys. Unlike the
+// other formats, the page is read whole (io.ReadAll) before its table is parsed.
+func readHtmlRecords(reader *bufio.Reader) (recordReader, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read: %v", err)
+	}
+	var records [][]string
+	for _, table := range htmlTables.FindAll(data, -1) {
+		var tableRecords [][]string
+		for _, row := range htmlRows.FindAllSubmatch(table, -1) {
+			var record []string
+			for _, cell := range htmlCells.FindAllSubmatch(row[1], -1) {
+				text := htmlTags.ReplaceAllString(htmlBreaks.ReplaceAllString(string(cell[1]), "\n"), "")
+				var lines []string
+				for _, line := range strings.Split(html.UnescapeString(text), "\n") {
+					if line = strings.Join(strings.Fields(line), " "); len(line) > 0 {
+						lines = append(lines, line)
+					}
+				}
+				record = append(record, strings.Join(lines, "\n"))
+			}
+			if len(record) > 0 {
+				tableRecords = append(tableRecords, record)
+			}
+		}
+		if len(tableRecords) > len(records) {
+			records = tableRecords
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no table found")
+	}
+	// cells spanning columns leave rows short, so pad them to the header's width
+	for i := range records {
+		for len(records[i]) < len(records[0]) {
+			records[i] = append(records[i], "")
+		}
+	}
+	return &sliceRecords{records: records}, nil
+}
+
+// tabulate lays out rows of (header, value) cells the way Jira's CSV export
+// does: a header gets one column per value in the row that uses it most.
+func tabulate(rows [][][2]string) recordReader {
+	var headers []string
+	widths := make(map[string]int)
+	for _, row := range rows {
+		counts := make(map[string]int)
+		for _, cell := range row {
+			counts[cell[0]]++
+			if counts[cell[0]] > widths[cell[0]] {
+				if widths[cell[0]] == 0 {
+					headers = append(headers, cell[0])
+				}
+				widths[cell[0]] = counts[cell[0]]
+			}
+		}
+	}
+
+	offsets := make(map[string]int)
+	var header []string
+	for _, name := range headers {
+		offsets[name] = len(header)
+		for i := 0; i < widths[name]; i++ {
+			header = append(header, name)
+		}
+	}
+
+	records := [][]string{header}
+	for _, row := range rows {
+		record := make([]string, len(header))
+		used := make(map[string]int)
+		for _, cell := range row {
+			record[offsets[cell[0]]+used[cell[0]]] = cell[1]
+			used[cell[0]]++
+		}
+		records = append(records, record)
+	}
+	return &sliceRecords{records: records}
+}
+
+func linkHeader(direction string, linkType string) string {
+	return fmt.Sprintf("%s issue link (%s)", direction, linkType)
+}
+
+// jsonIssue is an issue as returned by Jira's REST search API.
+type jsonIssue struct {
+	Id     string `json:"id"`
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string          `json:"summary"`
+		Description json.RawMessage `json:"description"`
+		Status      struct {
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Name string `json:"name"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		Priority *struct {
+			Name string `json:"name"`
+		} `json:"priority"`
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Assignee *struct {
+			EmailAddress string `json:"emailAddress"`
+			DisplayName  string `json:"displayName"`
+		} `json:"assignee"`
+		Labels  []string `json:"labels"`
+		DueDate string   `json:"duedate"`
+		Created string   `json:"created"`
+		Updated string   `json:"updated"`
+		Parent  *struct {
+			Key string `json:"key"`
+		} `json:"parent"`
+		Subtasks []struct {
+			Key string `json:"key"`
+		} `json:"subtasks"`
+		IssueLinks []struct {
+			Type struct {
+				Name string `json:"name"`
+			} `json:"type"`
+			InwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"inwardIssue"`
+			OutwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"outwardIssue"`
+		} `json:"issuelinks"`
+	} `json:"fields"`
+}
+
+// readJsonRecords accepts a REST search result ({"issues": [...]}) or a bare array of issues.
+// The issues are decoded one at a time, so the document's text is never held whole; their rows
+// are still all collected, and tabulated into a copy, so the issues themselves have to fit in memory.
+func readJsonRecords(reader *bufio.Reader) (recordReader, error) {
+	var rows [][][2]string
+	err := decodeJsonIssues(json.NewDecoder(reader), func(jsonIssue jsonIssue) {
+		rows = append(rows, jsonRow(jsonIssue))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse JSON: %v", err)
+	}
+	return tabulate(rows), nil
+}
+
+// decodeJsonIssues streams the issues of a search result's "issues" array, or of a bare array,
+// to visit, skipping the result's other fields.
+func decodeJsonIssues(decoder *json.Decoder, visit func(jsonIssue)) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	for token == json.Delim('{') {
+		name, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if name == json.Delim('}') {
+			return nil
+		}
+		if name != "issues" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return err
+			}
+			continue
+		}
+		if token, err = decoder.Token(); err != nil {
+			return err
+		}
+	}
+	if token == nil {
+		return nil
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("expected an array of issues")
+	}
+	for decoder.More() {
+		var issue jsonIssue
+		if err := decoder.Decode(&issue); err != nil {
+			return err
+		}
+		visit(issue)
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// jsonRow turns an issue of the REST API into named cells for tabulate.
+func jsonRow(jsonIssue jsonIssue) [][2]string {
+	row := [][2]string{
+		{"Issue key", jsonIssue.Key},
+		{"Summary", jsonIssue.Fields.Summary},
+		{"Status", jsonIssue.Fields.Status.Name},
+		{"Issue Type", jsonIssue.Fields.IssueType.Name},
+		{"Status Category", jsonIssue.Fields.Status.StatusCategory.Name},
+	}
+	if jsonIssue.Fields.Priority != nil {
+		row = append(row, [2]string{"Priority", jsonIssue.Fields.Priority.Name})
+	}
+	if assignee := jsonIssue.Fields.Assignee; assignee != nil {
+		if len(assignee.EmailAddress) > 0 {
+			row = append(row, [2]string{"Assignee", assignee.EmailAddress})
+		} else {
+			row = append(row, [2]string{"Assignee", assignee.DisplayName})
+		}
+	}
+	row = append(row, [2]string{"Issue id", jsonIssue.Id})
+	if jsonIssue.Fields.Parent != nil {
+		row = append(row, [2]string{"Parent", jsonIssue.Fields.Parent.Key})
+	}
+	var subtasks []string
+	for _, subtask := range jsonIssue.Fields.Subtasks {
+		subtasks = append(subtasks, subtask.Key)
+	}
+	row = append(row, [2]string{"Sub-tasks", strings.Join(subtasks, ",")})
+	for _, label := range jsonIssue.Fields.Labels {
+		row = append(row, [2]string{"Labels", label})
+	}
+	row = append(row, [2]string{"Description", jsonDescription(jsonIssue.Fields.Description)})
+	row = append(row, [2]string{"Due Date", jsonIssue.Fields.DueDate}, [2]string{"Created", jsonIssue.Fields.Created},
+		[2]string{"Updated", jsonIssue.Fields.Updated})
+	for _, link := range jsonIssue.Fields.IssueLinks {
+		if link.InwardIssue != nil {
+			row = append(row, [2]string{linkHeader("Inward", link.Type.Name), link.InwardIssue.Key})
+		}
+		if link.OutwardIssue != nil {
+			row = append(row, [2]string{linkHeader("Outward", link.Type.Name), link.OutwardIssue.Key})
+		}
+	}
+	return row
+}
+
+// markupRules rewrite Jira wiki markup, and the smart links Jira pastes, to plain text, in order.
+var markupRules = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\{(?:code|noformat|quote|panel|color)(?::[^}]*)?\}`), ""},
+	{regexp.MustCompile(`\[([^|\]]+)\|[^\]]*\]`), "$1"},
+	{regexp.MustCompile(`\[~(?:accountid:)?([^\]]+)\]`), "@$1"},
+	{regexp.MustCompile(`\[((?:https?|mailto):[^\]]+)\]`), "$1"},
+	{regexp.MustCompile(`!([^!\s|]+\.(?:png|jpe?g|gif|svg))(?:\|[^!]*)?!`), ""},
+	{regexp.MustCompile(`\{\{([^}]*)\}\}`), "$1"},
+	{regexp.MustCompile(`(?m)^\s*(?:h[1-6]\.|bq\.|[*#-]+)\s+`), ""},
+	{regexp.MustCompile(`(^|[\s(])[*_+]([^\s*_+](?:[^*_+\n]*[^\s*_+])?)[*_+]($|[\s).,:;!?])`), "$1$2$3"},
+}
+
+// cleanMarkup strips Jira wiki markup from summaries and descriptions: links become their
+// text, formatting marks and macros go, and mentions become '@name'.
+func cleanMarkup(text string) string {
+	for _, rule := range markupRules {
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// jsonDescription returns a JSON description's text: the string of REST API v2, or the text of
+// the Atlassian Document Format document of v3, a line per paragraph.
+func jsonDescription(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var document adfNode
+	if json.Unmarshal(raw, &document) != nil {
+		return ""
+	}
+	var lines []string
+	var collect func(node adfNode, line *strings.Builder)
+	collect = func(node adfNode, line *strings.Builder) {
+		line.WriteString(node.Text)
+		for _, child := range node.Content {
+			if child.Type == "paragraph" || child.Type == "heading" || child.Type == "listItem" {
+				var childLine strings.Builder
+				collect(child, &childLine)
+				if len(strings.TrimSpace(childLine.String())) > 0 {
+					lines = append(lines, strings.TrimSpace(childLine.String()))
+				}
+			} else {
+				collect(child, line)
+			}
+		}
+	}
+	var rest strings.Builder
+	collect(document, &rest)
+	if len(strings.TrimSpace(rest.String())) > 0 {
+		lines = append(lines, strings.TrimSpace(rest.String()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// adfNode is a node of an Atlassian Document Format document.
+type adfNode struct {
+	Type    string    `json:"type"`
+	Text    string    `json:"text"`
+	Content []adfNode `json:"content"`
+}
+
+// xmlItem is an issue from Jira's XML (RSS) export.
+type xmlItem struct {
+	Key      string `xml:"key"`
+	Summary  string `xml:"summary"`
+	Status   string `xml:"status"`
+	Priority string `xml:"priority"`
+	Type     string `xml:"type"`
+	Assignee struct {
+		Username string `xml:"username,attr"`
+		Name     string `xml:",chardata"`
+	} `xml:"assignee"`
+	Labels      []string `xml:"labels>label"`
+	Description string   `xml:"description"`
+	Due         string   `xml:"due"`
+	Created     string   `xml:"created"`
+	Updated     string   `xml:"updated"`
+	Parent      string   `xml:"parent"`
+	Subtasks    []string `xml:"subtasks>subtask"`
+	LinkTypes   []struct {
+		Name    string   `xml:"name"`
+		Inward  []string `xml:"inwardlinks>issuelink>issuekey"`
+		Outward []string `xml:"outwardlinks>issuelink>issuekey"`
+	} `xml:"issuelinks>issuelinktype"`
+	CustomFields []struct {
+		Name   string   `xml:"customfieldname"`
+		Values []string `xml:"customfieldvalues>customfieldvalue"`
+	} `xml:"customfields>customfield"`
+}
+
+// readXmlRecords reads the items of an RSS export one at a time, so the document's text is never
+// held whole; like readJsonRecords, it still collects every item's row for tabulate.
+func readXmlRecords(reader *bufio.Reader) (recordReader, error) {
+	var rows [][][2]string
+	decoder := xml.NewDecoder(reader)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse XML: %v", err)
+		}
+		if start, isStart := token.(xml.StartElement); isStart && start.Name.Local == "item" {
+			var item xmlItem
+			if err := decoder.DecodeElement(&item, &start); err != nil {
+				return nil, fmt.Errorf("couldn't parse XML: %v", err)
+			}
+			rows = append(rows, xmlRow(item))
+		}
+	}
+	return tabulate(rows), nil
+}
+
+// xmlRow turns an RSS item into named cells for tabulate.
+func xmlRow(item xmlItem) [][2]string {
+	row := [][2]string{
+		{"Issue key", item.Key},
+		{"Summary", item.Summary},
+		{"Status", item.Status},
+		{"Priority", item.Priority},
+		{"Issue Type", item.Type},
+	}
+	if len(item.Assignee.Username) > 0 {
+		row = append(row, [2]string{"Assignee", item.Assignee.Username})
+	} else {
+		row = append(row, [2]string{"Assignee", item.Assignee.Name})
+	}
+	if len(item.Parent) > 0 {
+		row = append(row, [2]string{"Parent", item.Parent})
+	}
+	row = append(row, [2]string{"Sub-tasks", strings.Join(item.Subtasks, ",")})
+	for _, label := range item.Labels {
+		row = append(row, [2]string{"Labels", label})
+	}
+	description := htmlTags.ReplaceAllString(htmlBreaks.ReplaceAllString(item.Description, "\n"), "")
+	row = append(row, [2]string{"Description", strings.TrimSpace(html.UnescapeString(description))})
+	row = append(row, [2]string{"Due Date", item.Due}, [2]string{"Created", item.Created},
+		[2]string{"Updated", item.Updated})
+	for _, linkType := range item.LinkTypes {
+		for _, key := range linkType.Inward {
+			row = append(row, [2]string{linkHeader("Inward", linkType.Name), key})
+		}
+		for _, key := range linkType.Outward {
+			row = append(row, [2]string{linkHeader("Outward", linkType.Name), key})
+		}
+	}
+	for _, field := range item.CustomFields {
+		for _, value := range field.Values {
+			row = append(row, [2]string{fmt.Sprintf("Custom field (%s)", field.Name), value})
+		}
+	}
+	return row
+}
+
+func readHeader(input recordReader, options Options) (HeaderInfo, error) {
+	var headerInfo HeaderInfo
+	headerInfo.issueKeyIdx = -1
+	headerInfo.summaryIdx = -1
+	headerInfo.statusIdx = -1
+	headerInfo.teamIdx = -1
+	headerInfo.priorityIdx = -1
+	headerInfo.pointsIdx = -1
+	headerInfo.typeIdx = -1
+	headerInfo.assigneeIdx = -1
+	headerInfo.subtaskIdx = -1
+	headerInfo.idIdx = -1
+	headerInfo.categoryIdx = -1
+	headerInfo.dueIdx = -1
+	headerInfo.createdIdx = -1
+	headerInfo.updatedIdx = -1
+	headerInfo.descIdx = -1
+
+	headerFields := headerFieldsFor(options)
+	columns, err := input.Read()
+	if err != nil {
+		return headerInfo, fmt.Errorf("couldn't read: %v", err)
+	}
+	headerInfo.columnCount = len(columns)
+	for i, col := range columns {
+		for _, badge := range options.config.Badges {
+			name := strings.TrimSpace(col)
+			if strings.EqualFold(name, badge.Field) || strings.EqualFold(name, "Custom field ("+badge.Field+")") {
+				headerInfo.badgeColumns = append(headerInfo.badgeColumns, BadgeColumn{idx: i, badge: badge})
+			}
+		}
+		switch headerFields[strings.TrimSpace(col)] {
+		case fieldIssueKey:
+			headerInfo.issueKeyIdx = i
+
+		case fieldSummary:
+			headerInfo.summaryIdx = i
+
+		case fieldStatus:
+			headerInfo.statusIdx = i
+
+		case fieldBlocker:
+			headerInfo.blockerIdx = append(headerInfo.blockerIdx, i)
+
+		case fieldBlocked:
+			headerInfo.blockedIdx = append(headerInfo.blockedIdx, i)
+
+		case fieldTeam:
+			headerInfo.teamIdx = i
+
+		case fieldPriority:
+			headerInfo.priorityIdx = i
+
+		case fieldPoints:
+			headerInfo.pointsIdx = i
+
+		case fieldType:
+			headerInfo.typeIdx = i
+
+		case fieldAssignee:
+			headerInfo.assigneeIdx = i
+
+		case fieldLabels:
+			headerInfo.labelIdx = append(headerInfo.labelIdx, i)
+
+		case fieldSprints:
+			headerInfo.sprintIdx = append(headerInfo.sprintIdx, i)
+
+		case fieldDue:
+			headerInfo.dueIdx = i
+
+		case fieldCreated:
+			headerInfo.createdIdx = i
+
+		case fieldUpdated:
+			headerInfo.updatedIdx = i
+
+		case fieldDesc:
+			headerInfo.descIdx = i
+
+		case fieldParent:
+			headerInfo.parentIdx = append(headerInfo.parentIdx, i)
+
+		case fieldIssueId:
+			headerInfo.idIdx = i
+
+		case fieldSubtasks:
+			headerInfo.subtaskIdx = i
+
+		case fieldCategory:
+			headerInfo.categoryIdx = i
+
+		default:
+			linkType, outward, isLink := linkColumnType(strings.TrimSpace(col))
+			_, wanted := options.linkTypes[strings.ToLower(linkType)]
+			if options.mergeDuplicates && strings.EqualFold(linkType, duplicateLinkType) {
+				wanted = true
+			}
+			if isLink && wanted {
+				headerInfo.linkColumns = append(headerInfo.linkColumns, LinkColumn{idx: i, linkType: linkType, outward: outward})
+			}
+		}
+	}
+	if headerInfo.issueKeyIdx == -1 && headerInfo.idIdx != -1 {
+		logEvent(options, "warning", "keyed_by_id", nil,
+			"'Issue key' not found; identifying tickets by 'Issue id' instead, so links given by key won't match")
+		headerInfo.issueKeyIdx = headerInfo.idIdx
+	}
+	if headerInfo.issueKeyIdx == -1 {
+		return headerInfo, fmt.Errorf("'Issue key' not found\n")
+	}
+
+	return headerInfo, nil
+}
+
+// linkColumnType recognizes link columns of any type, in any export language, by the
+// header names Jira uses for Blocks.
+func linkColumnType(col string) (string, bool, bool) {
+	for _, lang := range sortedKeys(headerAliases) {
+		for _, field := range []string{fieldBlocker, fieldBlocked} {
+			for _, name := range headerAliases[lang][field] {
+				prefix, isLink := strings.CutSuffix(name, "Blocks)")
+				if linkType, found := strings.CutPrefix(col, prefix); isLink && found && strings.HasSuffix(linkType, ")") {
+					return strings.TrimSuffix(linkType, ")"), field == fieldBlocked, true
+				}
+			}
+		}
+	}
+	return "", false, false
+}
+
+// headerFieldsFor maps header names to fields. Config aliases take precedence,
+// then -teamField and English; other languages apply when selected with -lang,
+// or all of them when -lang is empty.
+func headerFieldsFor(options Options) map[string]string {
+	headerFields := make(map[string]string)
+	addNames := func(field string, names []string) {
+		for _, name := range names {
+			if _, taken := headerFields[name]; !taken {
+				headerFields[name] = field
+			}
+		}
+	}
+	addAliases := func(lang string) {
+		for field, names := range headerAliases[lang] {
+			addNames(field, names)
+		}
+	}
+
+	addNames(fieldBlocker, options.blockerColumns)
+	addNames(fieldBlocked, options.blockedColumns)
+	for _, field := range sortedKeys(options.config.Headers) {
+		addNames(field, options.config.Headers[field])
+	}
+	addNames(fieldTeam, []string{options.teamField, fmt.Sprintf("Custom field (%s)", options.teamField)})
+	addAliases("en")
+	if len(options.lang) > 0 {
+		addAliases(options.lang)
+	} else {
+		for _, lang := range sortedKeys(headerAliases) {
+			addAliases(lang)
+		}
+	}
+	return headerFields
+}
+
+func readIssues(input recordReader, name string, site string, headerInfo *HeaderInfo, options Options,
+	issues *map[string]IssueInfo, report *Report) error {
+	for {
+		columns, err := input.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.addMalformed(input, name, "unparseable row")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read: %v", err)
+		}
+		if reason := checkRow(headerInfo, columns); len(reason) > 0 {
+			report.addMalformed(input, name, reason)
+			continue
+		}
+		if len(site) > 0 {
+			prefixColumns(headerInfo, columns, site)
+		}
+		if len(columns) > headerInfo.issueKeyIdx {
+			issueKey := strings.TrimSpace(columns[headerInfo.issueKeyIdx])
+			if len(issueKey) > 0 {
+				_, hideIt := (options.hideKeys)[issueKey]
+				_, showIt := (options.showKeys)[issueKey]
+				if hideIt && !showIt {
+					report.addHidden(issueKey)
+				}
+				if showIt || !hideIt {
+					var issue IssueInfo
+					issue.issueKey = issueKey
+					if headerInfo.summaryIdx != -1 && len(columns) > headerInfo.summaryIdx {
+						issue.summary = cleanMarkup(columns[headerInfo.summaryIdx])
+					}
+					if headerInfo.statusIdx != -1 && len(columns) > headerInfo.statusIdx {
+						issue.status = columns[headerInfo.statusIdx]
+					}
+					if headerInfo.teamIdx != -1 && len(columns) > headerInfo.teamIdx {
+						issue.team = strings.TrimSpace(columns[headerInfo.teamIdx])
+					}
+					if headerInfo.priorityIdx != -1 && len(columns) > headerInfo.priorityIdx {
+						issue.priority = strings.TrimSpace(columns[headerInfo.priorityIdx])
+					}
+					if headerInfo.pointsIdx != -1 && len(columns) > headerInfo.pointsIdx {
+						issue.points, _ = strconv.ParseFloat(strings.TrimSpace(columns[headerInfo.pointsIdx]), 64)
+					}
+					if headerInfo.typeIdx != -1 && len(columns) > headerInfo.typeIdx {
+						issue.issueType = strings.TrimSpace(columns[headerInfo.typeIdx])
+					}
+					if headerInfo.assigneeIdx != -1 && len(columns) > headerInfo.assigneeIdx {
+						issue.assignee = strings.TrimSpace(columns[headerInfo.assigneeIdx])
+					}
+					// exports can carry both Parent and Epic Link; the first that's filled in wins
+					for _, parentIdx := range headerInfo.parentIdx {
+						if len(issue.parent) == 0 && len(columns) > parentIdx {
+							issue.parent = strings.TrimSpace(columns[parentIdx])
+						}
+					}
+					if headerInfo.subtaskIdx != -1 && len(columns) > headerInfo.subtaskIdx {
+						issue.subtasks = strings.FieldsFunc(columns[headerInfo.subtaskIdx], func(r rune) bool {
+							return r == ',' || r == ';' || unicode.IsSpace(r)
+						})
+					}
+					if headerInfo.idIdx != -1 && len(columns) > headerInfo.idIdx {
+						issue.issueId = strings.TrimSpace(columns[headerInfo.idIdx])
+					}
+					for _, labelIdx := range headerInfo.labelIdx {
+						// Jira labels can't hold spaces, so a cell listing several is split on them.
+						if len(columns) > labelIdx {
+							issue.labels = append(issue.labels, strings.Fields(columns[labelIdx])...)
+						}
+					}
+					for _, column := range headerInfo.badgeColumns {
+						value := ""
+						if len(columns) > column.idx {
+							value = strings.TrimSpace(columns[column.idx])
+						}
+						badge := column.badge
+						matched := len(value) > 0 && (len(badge.Value) == 0 || strings.EqualFold(value, badge.Value))
+						if matched && !containsKey(&issue.badges, badge.Badge) {
+							issue.badges = append(issue.badges, badge.Badge)
+						}
+					}
+					for _, sprintIdx := range headerInfo.sprintIdx {
+						if len(columns) > sprintIdx && len(strings.TrimSpace(columns[sprintIdx])) > 0 {
+							issue.sprints = append(issue.sprints, strings.TrimSpace(columns[sprintIdx]))
+						}
+					}
+					if headerInfo.dueIdx != -1 && len(columns) > headerInfo.dueIdx {
+						issue.due = parseDate(columns[headerInfo.dueIdx])
+					}
+					if headerInfo.createdIdx != -1 && len(columns) > headerInfo.createdIdx {
+						issue.created = parseDate(columns[headerInfo.createdIdx])
+					}
+					if headerInfo.descIdx != -1 && len(columns) > headerInfo.descIdx {
+						issue.description = cleanMarkup(strings.TrimSpace(columns[headerInfo.descIdx]))
+					}
+					if headerInfo.updatedIdx != -1 && len(columns) > headerInfo.updatedIdx {
+						issue.updated = parseDate(columns[headerInfo.updatedIdx])
+					}
+					if headerInfo.categoryIdx != -1 && len(columns) > headerInfo.categoryIdx {
+						issue.category = strings.TrimSpace(columns[headerInfo.categoryIdx])
+					}
+					loadBlockers(headerInfo, &columns, options, &issue, issues, report)
+					loadBlocked(headerInfo, &columns, options, &issue, issues, report)
+					loadLinks(headerInfo, &columns, &issue)
+					report.addRow(&issue)
+
+					if existing, found := (*issues)[issue.issueKey]; found {
+						merge(&existing, &issue, issues)
+					} else {
+						(*issues)[issue.issueKey] = issue
+					}
+				}
+			}
+		}
+	}
+}
+
+// prefixColumns puts a -sitePrefix in front of every key and id in a row's key, id, parent,
+// sub-task and link columns, so tickets from different Jira sites can't collide.
+func prefixColumns(headerInfo *HeaderInfo, columns []string, site string) {
+	indexes := []int{headerInfo.issueKeyIdx, headerInfo.idIdx, headerInfo.subtaskIdx}
+	indexes = append(append(append(indexes, headerInfo.parentIdx...), headerInfo.blockerIdx...), headerInfo.blockedIdx...)
+	for _, column := range headerInfo.linkColumns {
+		indexes = append(indexes, column.idx)
+	}
+	for _, idx := range indexes {
+		if idx != -1 && len(columns) > idx {
+			keys := strings.FieldsFunc(columns[idx], func(r rune) bool {
+				return r == ',' || r == ';' || unicode.IsSpace(r)
+			})
+			for i := range keys {
+				keys[i] = site + "/" + keys[i]
+			}
+			columns[idx] = strings.Join(keys, ",")
+		}
+	}
+}
+
+// siteOf returns the -sitePrefix a key was given, or "".
+func siteOf(key string) string {
+	site, _, found := strings.Cut(key, "/")
+	if !found {
+		return ""
+	}
+	return site
+}
+
+// checkRow returns why a row can't be used, or "" when it's fine.
+func checkRow(headerInfo *HeaderInfo, columns []string) string {
+	if len(columns) != headerInfo.columnCount {
+		return "wrong column count"
+	}
+	if len(strings.TrimSpace(columns[headerInfo.issueKeyIdx])) == 0 {
+		return "missing issue key"
+	}
+	if !isWellFormedKey(strings.TrimSpace(columns[headerInfo.issueKeyIdx])) {
+		return "unparseable issue key"
+	}
+	for _, idx := range append(append([]int{}, headerInfo.blockerIdx...), headerInfo.blockedIdx...) {
+		for _, key := range splitKeys(columns[idx]) {
+			if !isWellFormedKey(key) {
+				return "unparseable issue link"
+			}
+		}
+	}
+	return ""
+}
+
+func isWellFormedKey(key string) bool {
+	return !strings.ContainsAny(key, " \t\r\n,;")
+}
+
+func (report *Report) addMalformed(input recordReader, name string, reason string) {
+	report.malformedRows = append(report.malformedRows,
+		MalformedRow{source: name, line: input.Line(), reason: reason, raw: input.Raw()})
+}
+
+// addRow remembers the first row seen for each key and compares later rows against it.
+func (report *Report) addRow(issue *IssueInfo) {
+	if report.firstRows == nil {
+		report.firstRows = make(map[string]IssueInfo)
+		report.duplicates = make(map[string]*DuplicateKey)
+	}
+	first, found := report.firstRows[issue.issueKey]
+	if !found {
+		report.firstRows[issue.issueKey] = *issue
+		return
+	}
+
+	duplicate, found := report.duplicates[issue.issueKey]
+	if !found {
+		duplicate = &DuplicateKey{rows: 1}
+		report.duplicates[issue.issueKey] = duplicate
+	}
+	duplicate.rows++
+	addConflict := func(field string, differs bool) {
+		if differs && !containsKey(&duplicate.conflicts, field) {
+			duplicate.conflicts = append(duplicate.conflicts, field)
+		}
+	}
+	addConflict("summary", first.summary != issue.summary)
+	addConflict("status", first.status != issue.status)
+	addConflict("team", first.team != issue.team)
+	addConflict("priority", first.priority != issue.priority)
+	addConflict("points", first.points != issue.points)
+	addConflict("issue type", first.issueType != issue.issueType)
+	addConflict("assignee", first.assignee != issue.assignee)
+	addConflict("labels", !sameKeys(first.labels, issue.labels))
+	addConflict("sprints", !sameKeys(first.sprints, issue.sprints))
+	addConflict("due date", !first.due.Equal(issue.due))
+	addConflict("created", !first.created.Equal(issue.created))
+	addConflict("parent", first.parent != issue.parent)
+	addConflict("blockers", !sameKeys(first.blockerKeys, issue.blockerKeys))
+	addConflict("blocked", !sameKeys(first.blockedKeys, issue.blockedKeys))
+}
+
+func (report *Report) addHidden(key string) {
+	if report.hiddenKeys == nil {
+		report.hiddenKeys = make(map[string]struct{})
+	}
+	report.hiddenKeys[key] = struct{}{}
+}
+
+// addFiltered records the tickets a rule hid, given their number before it ran, and returns
+// the number left.
+func (report *Report) addFiltered(rule string, before int, issues *map[string]IssueInfo) int {
+	if hidden := before - len(*issues); hidden > 0 {
+		report.filtered = append(report.filtered, FilterCount{rule: rule, tickets: hidden})
+	}
+	return len(*issues)
+}
+
+func (report *Report) addSelfLink(key string) {
+	if report.selfLinks == nil {
+		report.selfLinks = make(map[string]struct{})
+	}
+	report.selfLinks[key] = struct{}{}
+}
+
+// findDangling notes the keys that are only known as link targets, with no row of their own.
+func (report *Report) findDangling(issues *map[string]IssueInfo) {
+	for _, key := range sortedKeys(*issues) {
+		if _, found := report.firstRows[key]; !found {
+			report.danglingKeys = append(report.danglingKeys, key)
+		}
+	}
+}
+
+// findContradictions records pairs of tickets that each block the other where some
+// direction is missing from one ticket's rows. A cycle Jira really holds is recorded
+// by both tickets in both directions; a one-sided one points at inconsistent columns.
+func (report *Report) findContradictions(issues *map[string]IssueInfo) {
+	for _, key := range sortedKeys(*issues) {
+		issue := (*issues)[key]
+		for _, otherKey := range issue.blockedKeys {
+			other := (*issues)[otherKey]
+			_, hasRow := report.firstRows[key]
+			_, otherHasRow := report.firstRows[otherKey]
+			if key > otherKey || !hasRow || !otherHasRow || !containsKey(&other.blockedKeys, key) {
+				continue
+			}
+			recordedBoth := issue.blockedCounts[otherKey] > 0 && other.blockerCounts[key] > 0 &&
+				other.blockedCounts[key] > 0 && issue.blockerCounts[otherKey] > 0
+			if !recordedBoth {
+				report.contradictions = append(report.contradictions, [2]string{key, otherKey})
+			}
+		}
+	}
+}
+
+func (report *Report) conflictCount() int {
+	count := 0
+	for _, duplicate := range report.duplicates {
+		if len(duplicate.conflicts) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func sameKeys(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, key := range a {
+		if !containsKey(&b, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// logEvent reports something that happened during a run on stderr: as its message, or with
+// -logFormat json as an object of its level, event name and fields, one per line.
+func logEvent(options Options, level string, event string, fields map[string]any, message string) {
+	// -quiet keeps only errors and its own summary
+	if options.quiet && level != "error" && event != "summary" {
+		return
+	}
+	if options.logFormat != "json" {
+		_, _ = fmt.Fprintln(os.Stderr, message)
+		return
+	}
+	record := map[string]any{"level": level, "event": event}
+	for name, value := range fields {
+		record[name] = value
+	}
+	data, _ := json.Marshal(record)
+	_, _ = fmt.Fprintf(os.Stderr, "%s\n", data)
+}
+
+// logReport logs the report's findings as -logFormat json events, one per row, key or pair.
+func logReport(report *Report, options Options) {
+	for _, row := range report.malformedRows {
+		logEvent(options, "warning", "row_skipped", map[string]any{"source": row.source, "line": row.line,
+			"reason": row.reason}, "")
+	}
+	for _, key := range sortedKeys(report.duplicates) {
+		duplicate := report.duplicates[key]
+		logEvent(options, "info", "keys_merged", map[string]any{"key": key, "rows": duplicate.rows,
+			"conflicts": append([]string{}, duplicate.conflicts...)}, "")
+	}
+	for _, key := range sortedKeys(report.selfLinks) {
+		logEvent(options, "warning", "self_link_dropped", map[string]any{"key": key}, "")
+	}
+	for _, key := range report.danglingKeys {
+		logEvent(options, "warning", "dangling_link", map[string]any{"key": key, "project": projectKey(key)}, "")
+	}
+	for _, pair := range report.contradictions {
+		logEvent(options, "warning", "one_sided_cycle", map[string]any{"keys": pair[:]}, "")
+	}
+	for _, filter := range report.filtered {
+		logEvent(options, "info", "tickets_hidden", map[string]any{"rule": filter.rule, "tickets": filter.tickets}, "")
+	}
+	for _, key := range sortedKeys(report.centrality) {
+		logEvent(options, "info", "score", map[string]any{"metric": options.metrics, "key": key,
+			"score": report.centrality[key]}, "")
+	}
+}
+
+// writeReport summarizes the run's problems on stderr, and dumps malformed rows to -errorFile.
+func writeReport(report *Report, options Options) error {
+	if options.quiet {
+		summary := map[string]any{"issues": len(report.firstRows), "skipped": len(report.malformedRows),
+			"dangling": len(report.danglingKeys)}
+		logEvent(options, "info", "summary", summary, fmt.Sprintf("parsed %s issues, %s rows skipped, %s dangling links",
+			groupDigits(len(report.firstRows)), groupDigits(len(report.malformedRows)), groupDigits(len(report.danglingKeys))))
+	} else if options.logFormat == "json" {
+		logReport(report, options)
+	} else {
+		writeReportText(report, options)
+	}
+
+	if len(options.errorFilename) > 0 {
+		errorFile, err := os.Create(options.errorFilename)
+		if err != nil {
+			return fmt.Errorf("can't create error file (%s): %v", options.errorFilename, err)
+		}
+		output := bufio.NewWriter(errorFile)
+		for _, row := range report.malformedRows {
+			_, _ = output.WriteString(row.raw + "\n")
+		}
+		err = output.Flush()
+		_ = errorFile.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't flush: %v", err)
+		}
+	}
+	return nil
+}
+
+// groupDigits writes a count with thousands separators, e.g. 1,204.
+func groupDigits(n int) string {
+	digits := strconv.Itoa(n)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// writeReportText lists the report's findings on stderr, grouped for reading.
+func writeReportText(report *Report, options Options) {
+	if len(report.malformedRows) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "skipped %d malformed rows:\n", len(report.malformedRows))
+		byReason := make(map[string][]MalformedRow)
+		for _, row := range report.malformedRows {
+			byReason[row.reason] = append(byReason[row.reason], row)
+		}
+		for _, reason := range sortedKeys(byReason) {
+			var examples []string
+			for _, row := range byReason[reason] {
+				if len(examples) == 5 {
+					examples = append(examples, "...")
+					break
+				}
+				examples = append(examples, fmt.Sprintf("%s:%d", row.source, row.line))
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "  %s: %d (%s)\n", reason, len(byReason[reason]), strings.Join(examples, ", "))
+		}
+	}
+
+	if len(report.duplicates) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "found %d issue keys in more than one row:\n", len(report.duplicates))
+		for _, key := range sortedKeys(report.duplicates) {
+			duplicate := report.duplicates[key]
+			if len(duplicate.conflicts) > 0 {
+				_, _ = fmt.Fprintf(os.Stderr, "  %s: %d rows, conflicting %s\n", key, duplicate.rows,
+					strings.Join(duplicate.conflicts, ", "))
+			} else {
+				_, _ = fmt.Fprintf(os.Stderr, "  %s: %d rows, identical\n", key, duplicate.rows)
+			}
+		}
+	}
+
+	if len(report.selfLinks) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "dropped links from tickets to themselves: %s\n",
+			strings.Join(sortedKeys(report.selfLinks), ", "))
+	}
+
+	if len(report.danglingKeys) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "found %d linked tickets without rows of their own:\n", len(report.danglingKeys))
+		byProject := make(map[string][]string)
+		for _, key := range report.danglingKeys {
+			byProject[projectKey(key)] = append(byProject[projectKey(key)], key)
+		}
+		for _, project := range sortedKeys(byProject) {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s: %s\n", project, strings.Join(byProject[project], ", "))
+		}
+	}
+
+	if len(report.contradictions) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "found %d pairs of tickets blocking each other by only one side's rows:\n",
+			len(report.contradictions))
+		for _, pair := range report.contradictions {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s and %s\n", pair[0], pair[1])
+		}
+	}
+
+	if len(report.filtered) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "hid tickets by rule:\n")
+		for _, filter := range report.filtered {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s: %d\n", filter.rule, filter.tickets)
+		}
+	}
+
+	if len(report.centrality) > 0 {
+		ranked := sortedKeys(report.centrality)
+		sort.SliceStable(ranked, func(i, j int) bool { return report.centrality[ranked[i]] > report.centrality[ranked[j]] })
+		if len(ranked) > 10 {
+			ranked = ranked[:10]
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "highest %s scores:\n", options.metrics)
+		for _, key := range ranked {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s: %.4f\n", key, report.centrality[key])
+		}
+	}
+}
+
+func merge(target *IssueInfo, source *IssueInfo, issues *map[string]IssueInfo) {
+	if len(target.summary) == 0 {
+		target.summary = source.summary
+	}
+	if len(target.status) == 0 {
+		target.status = source.status
+	}
+	if len(target.team) == 0 {
+		target.team = source.team
+	}
+	if len(target.priority) == 0 {
+		target.priority = source.priority
+	}
+	if target.points == 0 {
+		target.points = source.points
+	}
+	if len(target.issueType) == 0 {
+		target.issueType = source.issueType
+	}
+	if len(target.assignee) == 0 {
+		target.assignee = source.assignee
+	}
+	if len(target.parent) == 0 {
+		target.parent = source.parent
+	}
+	if len(target.issueId) == 0 {
+		target.issueId = source.issueId
+	}
+	for _, subtask := range source.subtasks {
+		if !containsKey(&(*target).subtasks, subtask) {
+			(*target).subtasks = append((*target).subtasks, subtask)
+		}
+	}
+	for _, label := range source.labels {
+		if !containsKey(&(*target).labels, label) {
+			(*target).labels = append((*target).labels, label)
+		}
+	}
+	for _, badge := range source.badges {
+		if !containsKey(&(*target).badges, badge) {
+			(*target).badges = append((*target).badges, badge)
+		}
+	}
+	for _, sprint := range source.sprints {
+		if !containsKey(&(*target).sprints, sprint) {
+			(*target).sprints = append((*target).sprints, sprint)
+		}
+	}
+	if target.due.IsZero() {
+		target.due = source.due
+	}
+	if target.created.IsZero() {
+		target.created = source.created
+	}
+	if len(target.description) == 0 {
+		target.description = source.description
+	}
+	if source.updated.After(target.updated) {
+		target.updated = source.updated
+	}
+	if len(target.category) == 0 {
+		target.category = source.category
+	}
+	for _, blockerKey := range source.blockerKeys {
+		if !containsKey(&(*target).blockerKeys, blockerKey) {
+			(*target).blockerKeys = append((*target).blockerKeys, blockerKey)
+		}
+	}
+	for _, blockedKey := range source.blockedKeys {
+		if !containsKey(&(*target).blockedKeys, blockedKey) {
+			(*target).blockedKeys = append((*target).blockedKeys, blockedKey)
+		}
+	}
+	for _, link := range source.links {
+		if !containsLink(target.links, link) {
+			target.links = append(target.links, link)
+		}
+	}
+	target.blockerCounts = addCounts(target.blockerCounts, source.blockerCounts)
+	target.blockedCounts = addCounts(target.blockedCounts, source.blockedCounts)
+
+	(*issues)[target.issueKey] = *target
+}
+
+// addCounts adds the counts in source to target, creating target when needed.
+func addCounts(target map[string]int, source map[string]int) map[string]int {
+	if target == nil && len(source) > 0 {
+		target = make(map[string]int)
+	}
+	for key, count := range source {
+		target[key] += count
+	}
+	return target
+}
+
+func loadBlockers(headerInfo *HeaderInfo, columns *[]string, options Options, issue *IssueInfo, issues *map[string]IssueInfo,
+	report *Report) {
+	for _, idx := range headerInfo.blockerIdx {
+		if len(*columns) > idx {
+			for _, blockerKey := range splitKeys((*columns)[idx]) {
+				if blockerKey == issue.issueKey {
+					report.addSelfLink(issue.issueKey)
+					continue
+				}
+				_, hideBlocker := (options.hideKeys)[blockerKey]
+				if hideBlocker {
+					report.addHidden(blockerKey)
+				} else {
+					if issue.blockerCounts == nil {
+						issue.blockerCounts = make(map[string]int)
+					}
+					issue.blockerCounts[blockerKey]++
+					if containsKey(&issue.blockerKeys, blockerKey) {
+						continue
+					}
+					issue.blockerKeys = append(issue.blockerKeys, blockerKey)
+					_, ok := (*issues)[blockerKey]
+					if !ok {
+						var blocker IssueInfo
+						blocker.issueKey = blockerKey
+						blocker.blockedKeys = append(blocker.blockerKeys, issue.issueKey)
+						(*issues)[blockerKey] = blocker
+					}
+				}
+			}
+		}
+	}
+}
+
+func loadBlocked(headerInfo *HeaderInfo, columns *[]string, options Options, issue *IssueInfo, issues *map[string]IssueInfo,
+	report *Report) {
+	for _, idx := range headerInfo.blockedIdx {
+		if len(*columns) > idx {
+			for _, blockedKey := range splitKeys((*columns)[idx]) {
+				if blockedKey == issue.issueKey {
+					report.addSelfLink(issue.issueKey)
+					continue
+				}
+				_, hideBlocked := (options.hideKeys)[blockedKey]
+				if hideBlocked {
+					report.addHidden(blockedKey)
+				} else {
+					if issue.blockedCounts == nil {
+						issue.blockedCounts = make(map[string]int)
+					}
+					issue.blockedCounts[blockedKey]++
+					if containsKey(&issue.blockedKeys, blockedKey) {
+						continue
+					}
+					issue.blockedKeys = append(issue.blockedKeys, blockedKey)
+					_, ok := (*issues)[blockedKey]
+					if !ok {
+						var blocked IssueInfo
+						blocked.issueKey = blockedKey
+						blocked.blockerKeys = append(blocked.blockerKeys, issue.issueKey)
+						(*issues)[blockedKey] = blocked
+					}
+				}
+			}
+		}
+	}
+}
+
+// splitKeys reads the keys in a link cell, which some exports pack several of into one,
+// separated by semicolons, commas or newlines.
+func splitKeys(cell string) []string {
+	var keys []string
+	for _, key := range strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == ',' || r == '\n' || r == '\r' }) {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// loadLinks reads the row's -linkTypes links. Links to tickets without rows aren't drawn.
+func loadLinks(headerInfo *HeaderInfo, columns *[]string, issue *IssueInfo) {
+	for _, column := range headerInfo.linkColumns {
+		if len(*columns) > column.idx {
+			for _, key := range splitKeys((*columns)[column.idx]) {
+				if key == issue.issueKey {
+					continue
+				}
+				link := Link{linkType: column.linkType, from: key, to: issue.issueKey}
+				if column.outward {
+					link = Link{linkType: column.linkType, from: issue.issueKey, to: key}
+				}
+				if !containsLink(issue.links, link) {
+					issue.links = append(issue.links, link)
+				}
+			}
+		}
+	}
+}
+
+func containsLink(links []Link, searchLink Link) bool {
+	for _, link := range links {
+		if link == searchLink {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveLinkIds replaces links given by issue id, as some export templates write them,
+// with the keys the export's Issue id column gives those ids, dropping their placeholder tickets.
+func resolveLinkIds(issues *map[string]IssueInfo) {
+	rename := make(map[string]string)
+	for key, issue := range *issues {
+		if _, isKey := (*issues)[issue.issueId]; len(issue.issueId) > 0 && issue.issueId != key {
+			if !isKey || len((*issues)[issue.issueId].issueId) == 0 {
+				rename[issue.issueId] = key
+			}
+		}
+	}
+	if len(rename) == 0 {
+		return
+	}
+	for id := range rename {
+		delete(*issues, id)
+	}
+	renameReferences(issues, rename)
+}
+
+// resolveParents replaces parents given by issue id, as Jira Cloud's Parent column does,
+// with their keys, then gives each listed sub-task without a parent its parent.
+func resolveParents(issues *map[string]IssueInfo) {
+	keysById := make(map[string]string)
+	for key, issue := range *issues {
+		if len(issue.issueId) > 0 {
+			keysById[issue.issueId] = key
+		}
+	}
+	for key, issue := range *issues {
+		if parentKey, found := keysById[issue.parent]; found {
+			if _, isKey := (*issues)[issue.parent]; !isKey {
+				issue.parent = parentKey
+				(*issues)[key] = issue
+			}
+		}
+	}
+	for _, key := range sortedKeys(*issues) {
+		for _, subtaskKey := range (*issues)[key].subtasks {
+			if idKey, found := keysById[subtaskKey]; found {
+				subtaskKey = idKey
+			}
+			if subtask, found := (*issues)[subtaskKey]; found && len(subtask.parent) == 0 {
+				subtask.parent = key
+				(*issues)[subtaskKey] = subtask
+			}
+		}
+	}
+}
+
+// parentGroup names the group of a ticket's parent, or of the ticket itself when it's
+// a parent, for -groupByParent and the parent rollup. It's "" for tickets with neither.
+func parentGroup(issue *IssueInfo, issues *map[string]IssueInfo, parents map[string]struct{}) string {
+	parentKey := issue.parent
+	if _, isParent := parents[issue.issueKey]; isParent {
+		parentKey = issue.issueKey
+	}
+	if len(parentKey) == 0 {
+		return ""
+	}
+	if parent, found := (*issues)[parentKey]; found && len(parent.summary) > 0 {
+		return parentKey + " " + parent.summary
+	}
+	return parentKey
+}
+
+func parentKeys(issues *map[string]IssueInfo) map[string]struct{} {
+	parents := make(map[string]struct{})
+	for _, issue := range *issues {
+		if len(issue.parent) > 0 {
+			parents[issue.parent] = struct{}{}
+		}
+	}
+	return parents
+}
+
+func fillDependencies(issues *map[string]IssueInfo, options Options) {
+	for _, issue := range *issues {
+		for _, blockerKey := range issue.blockerKeys {
+			if blocker, found := (*issues)[blockerKey]; found {
+				if !containsKey(&blocker.blockedKeys, issue.issueKey) {
+					blocker.blockedKeys = append(blocker.blockedKeys, issue.issueKey)
+					(*issues)[blocker.issueKey] = blocker
+				}
+			} else {
+				logEvent(options, "warning", "blocker_not_found", map[string]any{"key": blockerKey},
+					"Blocker not found: "+blockerKey)
+			}
+		}
+		for _, blockedKey := range issue.blockedKeys {
+			if blocked, found := (*issues)[blockedKey]; found {
+				if !containsKey(&blocked.blockerKeys, issue.issueKey) {
+					blocked.blockerKeys = append(blocked.blockerKeys, issue.issueKey)
+					(*issues)[blocked.issueKey] = blocked
+				}
+			} else {
+				logEvent(options, "warning", "blocked_not_found", map[string]any{"key": blockedKey},
+					"Blocked not found: "+blockedKey)
+			}
+		}
+	}
+}
+
+// applyRoots keeps only the -roots tickets and everything transitively blocking them.
+func applyRoots(issues *map[string]IssueInfo, options Options) {
+	if len(options.roots) == 0 {
+		return
+	}
+	keep := make(map[string]struct{})
+	var pending []string
+	for _, root := range sortedKeys(options.roots) {
+		if _, found := (*issues)[root]; found {
+			pending = append(pending, root)
+		} else {
+			logEvent(options, "warning", "root_not_found", map[string]any{"key": root}, "root not found: "+root)
+		}
+	}
+	for len(pending) > 0 {
+		key := pending[0]
+		pending = pending[1:]
+		if _, kept := keep[key]; kept {
+			continue
+		}
+		keep[key] = struct{}{}
+		pending = append(pending, (*issues)[key].blockerKeys...)
+	}
+	keepIssues(issues, keep)
+}
+
+// applyAutoPrune drops leaves nothing shown waits on: done tickets, and those of the config's
+// autoPrune statuses and issue types, that block nothing. Pruning repeats, so finished chains go
+// entirely. Tickets named by -showKeys, -highlightKeys, -roots or -keysFile stay.
+func applyAutoPrune(issues *map[string]IssueInfo, options Options) {
+	for pruned := true; pruned; {
+		pruned = false
+		keep := make(map[string]struct{})
+		for key, issue := range *issues {
+			_, showIt := options.showKeys[key]
+			_, highlightIt := options.highlightKeys[key]
+			_, isRoot := options.roots[key]
+			_, isListed := options.fileKeys[key]
+			if len(issue.blockedKeys) == 0 && isPrunable(&issue, options) && !showIt && !highlightIt && !isRoot && !isListed {
+				pruned = true
+				continue
+			}
+			keep[key] = struct{}{}
+		}
+		keepIssues(issues, keep)
+	}
+}
+
+// isPrunable reports whether -autoPrune may drop a ticket that blocks nothing.
+func isPrunable(issue *IssueInfo, options Options) bool {
+	if isDone(issue, options) {
+		return true
+	}
+	for _, status := range options.config.AutoPrune.Statuses {
+		if strings.EqualFold(status, issue.status) {
+			return true
+		}
+	}
+	for _, issueType := range options.config.AutoPrune.IssueTypes {
+		if strings.EqualFold(issueType, issue.issueType) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEndpointsOnly keeps tickets with no blockers and tickets that block nothing,
+// linking each such start to the ends it leads to. Links through removed tickets
+// become chains.
+func applyEndpointsOnly(issues *map[string]IssueInfo) {
+	keep := make(map[string]struct{})
+	for key, issue := range *issues {
+		if len(issue.blockerKeys) == 0 || len(issue.blockedKeys) == 0 {
+			keep[key] = struct{}{}
+		}
+	}
+
+	for _, startKey := range sortedKeys(keep) {
+		start := (*issues)[startKey]
+		if len(start.blockerKeys) > 0 {
+			continue
+		}
+		descendants := reachable(issues, startKey, func(issue IssueInfo) []string { return issue.blockedKeys })
+		for _, endKey := range sortedKeys(descendants) {
+			end := (*issues)[endKey]
+			if len(end.blockedKeys) > 0 || containsKey(&start.blockedKeys, endKey) {
+				continue
+			}
+			ancestors := reachable(issues, endKey, func(issue IssueInfo) []string { return issue.blockerKeys })
+			hidden := 0
+			for key := range descendants {
+				if _, between := ancestors[key]; between && key != endKey {
+					hidden++
+				}
+			}
+			if start.chainedKeys == nil {
+				start.chainedKeys = make(map[string]int)
+			}
+			start.chainedKeys[endKey] = hidden
+			start.blockedKeys = append(start.blockedKeys, endKey)
+			end.blockerKeys = append(end.blockerKeys, startKey)
+			(*issues)[endKey] = end
+		}
+		(*issues)[startKey] = start
+	}
+	keepIssues(issues, keep)
+}
+
+// reachable returns every key reachable from key by following next, excluding key itself.
+func reachable(issues *map[string]IssueInfo, key string, next func(IssueInfo) []string) map[string]struct{} {
+	found := make(map[string]struct{})
+	pending := next((*issues)[key])
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if _, seen := found[current]; seen || current == key {
+			continue
+		}
+		found[current] = struct{}{}
+		pending = append(pending, next((*issues)[current])...)
+	}
+	return found
+}
+
+// openBlockers returns every ticket transitively blocking any of keys, and those of them
+// that aren't done, both in key order.
+func openBlockers(issues *map[string]IssueInfo, keys []string, options Options) ([]string, []string) {
+	found := make(map[string]struct{})
+	for _, key := range keys {
+		for blocker := range reachable(issues, key, func(issue IssueInfo) []string { return issue.blockerKeys }) {
+			found[blocker] = struct{}{}
+		}
+	}
+	blockers := sortedKeys(found)
+	var open []string
+	for _, key := range blockers {
+		if issue := (*issues)[key]; !isDone(&issue, options) {
+			open = append(open, key)
+		}
+	}
+	return blockers, open
+}
+
+// blockedDepths returns every key transitively blocked by key, with the length of
+// the shortest chain reaching it.
+func blockedDepths(issues *map[string]IssueInfo, key string) map[string]int {
+	depths := make(map[string]int)
+	pending := []string{key}
+	for depth := 1; len(pending) > 0; depth++ {
+		var next []string
+		for _, current := range pending {
+			for _, blockedKey := range (*issues)[current].blockedKeys {
+				if _, seen := depths[blockedKey]; !seen && blockedKey != key {
+					depths[blockedKey] = depth
+					next = append(next, blockedKey)
+				}
+			}
+		}
+		pending = next
+	}
+	return depths
+}
+
+// computeImpact counts, for each issue, the open issues transitively blocked by it.
+func computeImpact(issues *map[string]IssueInfo, options Options) {
+	for key, issue := range *issues {
+		issue.impact = 0
+		for blockedKey := range blockedDepths(issues, key) {
+			blocked := (*issues)[blockedKey]
+			if !isDone(&blocked, options) {
+				issue.impact++
+			}
+		}
+		(*issues)[key] = issue
+	}
+}
+
+// computeSlack schedules the open tickets from the options' now, critical-path style: each
+// finishes its duration (story points times -daysPerPoint, 1 point when unestimated) after its
+// last blocker, and must finish by its due date and in time for what it blocks to finish by theirs. Slack is
+// the difference, in days; tickets without a due date downstream stay unscheduled.
+func computeSlack(issues *map[string]IssueInfo, options Options) {
+	today := options.now.Truncate(24 * time.Hour)
+	duration := func(issue *IssueInfo) int {
+		if isDone(issue, options) {
+			return 0
+		}
+		return estimatedDays(issue, options)
+	}
+
+	// earliest finish, in days from today; a ticket on a cycle counts its blockers so far
+	earliest := make(map[string]int)
+	var finishEarliest func(key string) int
+	finishEarliest = func(key string) int {
+		if days, found := earliest[key]; found {
+			return days
+		}
+		earliest[key] = 0
+		issue := (*issues)[key]
+		start := 0
+		if !isDone(&issue, options) {
+			for _, blockerKey := range issue.blockerKeys {
+				start = max(start, finishEarliest(blockerKey))
+			}
+		}
+		earliest[key] = start + duration(&issue)
+		return earliest[key]
+	}
+
+	// latest finish, in days from today, or unconstrained when not found
+	latest := make(map[string]int)
+	visited := make(map[string]struct{})
+	var finishLatest func(key string) (int, bool)
+	finishLatest = func(key string) (int, bool) {
+		if _, seen := visited[key]; seen {
+			days, found := latest[key]
+			return days, found
+		}
+		visited[key] = struct{}{}
+		issue := (*issues)[key]
+		days, constrained := 0, false
+		if !issue.due.IsZero() {
+			days, constrained = int(math.Round(issue.due.Sub(today).Hours()/24)), true
+		}
+		for _, blockedKey := range issue.blockedKeys {
+			blocked := (*issues)[blockedKey]
+			if finish, found := finishLatest(blockedKey); found {
+				start := finish - duration(&blocked)
+				if !constrained || start < days {
+					days, constrained = start, true
+				}
+			}
+		}
+		if constrained {
+			latest[key] = days
+		}
+		return days, constrained
+	}
+
+	for key, issue := range *issues {
+		finish, constrained := finishLatest(key)
+		issue.scheduled = constrained && !isDone(&issue, options)
+		issue.slack = finish - finishEarliest(key)
+		(*issues)[key] = issue
+	}
+}
+
+// daysSince returns how many whole days before the options' now a date was.
+func daysSince(date time.Time, options Options) int {
+	return int(options.now.Sub(date).Hours() / 24)
+}
+
+// isStale reports whether a ticket is an open blocker not updated for longer than -staleAfter.
+func isStale(issue *IssueInfo, options Options) bool {
+	return options.staleAfter > 0 && len(issue.blockedKeys) > 0 && !issue.updated.IsZero() &&
+		!isDone(issue, options) && daysSince(issue.updated, options) > options.staleAfter
+}
+
+// parseDays reads a number of days, optionally suffixed with 'd', or a number of weeks suffixed with 'w'.
+func parseDays(value string) (int, error) {
+	multiplier := 1
+	if number, weeks := strings.CutSuffix(value, "w"); weeks {
+		value, multiplier = number, 7
+	} else {
+		value = strings.TrimSuffix(value, "d")
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("expected days like 21d or weeks like 3w")
+	}
+	return days * multiplier, nil
+}
+
+// maxReadBuffer is the largest -readBuffer, since the buffer is allocated in full up front.
+const maxReadBuffer = 256 << 20
+
+// parseSize reads a size in bytes, like 4096, 64KB or 16MB (KB being 1024 bytes).
+func parseSize(value string) (int, error) {
+	multiplier := 1
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	for i, unit := range []string{"KB", "MB", "GB"} {
+		if number, found := strings.CutSuffix(upper, unit); found {
+			upper, multiplier = strings.TrimSpace(number), 1<<(10*(i+1))
+		}
+	}
+	size, err := strconv.Atoi(upper)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("expected a size like 64KB or 16MB")
+	}
+	return size * multiplier, nil
+}
+
+// ageColor returns the -ageColors color of the highest threshold an open ticket's age exceeds, or "".
+func ageColor(issue *IssueInfo, options Options) string {
+	if !options.showAge || issue.created.IsZero() || isDone(issue, options) {
+		return ""
+	}
+	age := daysSince(issue.created, options)
+	color, highest := "", -1
+	for threshold, thresholdColor := range options.ageColors {
+		if age > threshold && threshold > highest {
+			color, highest = thresholdColor, threshold
+		}
+	}
+	return color
+}
+
+// estimatedDays is a ticket's story points times -daysPerPoint, rounded up, counting one point when unestimated.
+func estimatedDays(issue *IssueInfo, options Options) int {
+	points := issue.points
+	if points == 0 {
+		points = 1
+	}
+	return int(math.Ceil(points * options.daysPerPoint))
+}
+
+// parseDate reads a date as Jira exports write it, such as '2026-10-15', '15/Oct/26 12:00 AM'
+// or, in XML, 'Thu, 15 Oct 2026 00:00:00 +0000'. It's zero when empty or unrecognized.
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.DateOnly, time.RFC3339, "2006-01-02T15:04:05.000-0700", time.DateTime,
+		"2006-01-02 15:04", "2/Jan/06 3:04 PM", "2/Jan/06", "2/Jan/2006", time.RFC1123Z, time.RFC1123} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+		}
+	}
+	return time.Time{}
+}
+
+// blockingScore weighs each open ticket transitively blocked by key; tickets it
+// blocks directly count twice. See dependentWeight.
+func blockingScore(issues *map[string]IssueInfo, key string, options Options) float64 {
+	score := 0.0
+	for blockedKey, depth := range blockedDepths(issues, key) {
+		blocked := (*issues)[blockedKey]
+		if isDone(&blocked, options) {
+			continue
+		}
+		score += dependentWeight(&blocked)
+		if depth == 1 {
+			score += dependentWeight(&blocked)
+		}
+	}
+	return score
+}
+
+// openDependents counts the open tickets key blocks directly, and transitively.
+func openDependents(issues *map[string]IssueInfo, key string, options Options) (int, int) {
+	direct, transitive := 0, 0
+	for blockedKey, depth := range blockedDepths(issues, key) {
+		blocked := (*issues)[blockedKey]
+		if !isDone(&blocked, options) {
+			transitive++
+			if depth == 1 {
+				direct++
+			}
+		}
+	}
+	return direct, transitive
+}
+
+// priorityWeights scales dependents by priority, using the names of Jira's default
+// scheme and its older one. Other priorities weigh as "Medium".
+var priorityWeights = map[string]float64{
+	"HIGHEST": 5, "BLOCKER": 5,
+	"HIGH": 4, "CRITICAL": 4,
+	"MEDIUM": 3, "MAJOR": 3,
+	"LOW": 2, "MINOR": 2,
+	"LOWEST": 1, "TRIVIAL": 1,
+}
+
+// dependentWeight is a ticket's priority weight times its story points (1 when unestimated).
+func dependentWeight(issue *IssueInfo) float64 {
+	weight, found := priorityWeights[strings.ToUpper(issue.priority)]
+	if !found {
+		weight = priorityWeights["MEDIUM"]
+	}
+	if issue.points > 0 {
+		weight *= issue.points
+	}
+	return weight
+}
+
+// statusCategory is the ticket's Jira status category ("To Do", "In Progress" or
+// "Done"), guessed from its status when the input has no category. Tickets without
+// a status have none.
+func statusCategory(issue *IssueInfo, options Options) string {
+	switch {
+	case len(issue.category) > 0:
+		return issue.category
+	case len(issue.status) == 0:
+		return ""
+	case isDone(issue, options):
+		return "Done"
+	case strings.Contains(strings.ToUpper(issue.status), "PROGRESS") || strings.Contains(strings.ToUpper(issue.status), "REVIEW"):
+		return "In Progress"
+	}
+	return "To Do"
+}
+
+func isDone(issue *IssueInfo, options Options) bool {
+	if strings.EqualFold(issue.category, "Done") {
+		return true
+	}
+	_, done := options.doneStatuses[strings.ToUpper(strings.TrimSpace(issue.status))]
+	return done
+}
+
+// computeCentrality scores every issue with the -metrics measure. For PageRank, rank
+// flows from each ticket to its blockers, so tickets many others wait on score high.
+func computeCentrality(issues *map[string]IssueInfo, options Options) {
+	var scores map[string]float64
+	if options.metrics == "betweenness" {
+		scores = betweenness(issues)
+	} else {
+		scores = pageRank(issues)
+	}
+	for key, issue := range *issues {
+		issue.centrality = scores[key]
+		(*issues)[key] = issue
+	}
+}
+
+func pageRank(issues *map[string]IssueInfo) map[string]float64 {
+	const damping = 0.85
+	count := float64(len(*issues))
+	ranks := make(map[string]float64)
+	for key := range *issues {
+		ranks[key] = 1 / count
+	}
+	for iteration := 0; iteration < 100; iteration++ {
+		next := make(map[string]float64)
+		leaked := 0.0
+		for key, issue := range *issues {
+			if len(issue.blockerKeys) == 0 {
+				leaked += ranks[key]
+				continue
+			}
+			for _, blockerKey := range issue.blockerKeys {
+				next[blockerKey] += ranks[key] / float64(len(issue.blockerKeys))
+			}
+		}
+		change := 0.0
+		for key := range *issues {
+			rank := (1-damping)/count + damping*(next[key]+leaked/count)
+			change += math.Abs(rank - ranks[key])
+			next[key] = rank
+		}
+		ranks = next
+		if change < 1e-9 {
+			break
+		}
+	}
+	return ranks
+}
+
+// betweenness is Brandes' algorithm over blocks links, normalized to 0..1.
+func betweenness(issues *map[string]IssueInfo) map[string]float64 {
+	scores := make(map[string]float64)
+	for source := range *issues {
+		var order []string
+		paths := map[string]float64{source: 1}
+		distances := map[string]int{source: 0}
+		predecessors := make(map[string][]string)
+		pending := []string{source}
+		for len(pending) > 0 {
+			current := pending[0]
+			pending = pending[1:]
+			order = append(order, current)
+			for _, next := range (*issues)[current].blockedKeys {
+				if _, seen := distances[next]; !seen {
+					distances[next] = distances[current] + 1
+					pending = append(pending, next)
+				}
+				if distances[next] == distances[current]+1 {
+					paths[next] += paths[current]
+					predecessors[next] = append(predecessors[next], current)
+				}
+			}
+		}
+		dependencies := make(map[string]float64)
+		for i := len(order) - 1; i >= 0; i-- {
+			current := order[i]
+			for _, predecessor := range predecessors[current] {
+				dependencies[predecessor] += paths[predecessor] / paths[current] * (1 + dependencies[current])
+			}
+			if current != source {
+				scores[current] += dependencies[current]
+			}
+		}
+	}
+	if count := float64(len(*issues)); count > 2 {
+		for key := range scores {
+			scores[key] /= (count - 1) * (count - 2)
+		}
+	}
+	return scores
+}
+
+// pointsSize buckets story points into a t-shirt size, or "" for unestimated tickets.
+func pointsSize(points float64) string {
+	switch {
+	case points <= 0:
+		return ""
+	case points <= 1:
+		return "XS"
+	case points <= 3:
+		return "S"
+	case points <= 5:
+		return "M"
+	case points <= 8:
+		return "L"
+	default:
+		return "XL"
+	}
+}
+
+// shading returns a background color from white to light coral by score relative to the highest.
+func shading(score float64, highest float64) string {
+	if highest <= 0 {
+		return "#FFFFFF"
+	}
+	fraction := score / highest
+	green := 255 - int(fraction*float64(255-0x80))
+	return fmt.Sprintf("#FF%02X%02X", green, green)
+}
+
+// closeCycle returns the shortest cycle the link from key to blockedKey closes, as
+// 'A -> B -> A', or "" when there's none or closed already holds one of the same tickets.
+func closeCycle(issues *map[string]IssueInfo, key string, blockedKey string, closed map[string]struct{}) string {
+	path := shortestPath(issues, blockedKey, key)
+	if path == nil {
+		return ""
+	}
+	members := append([]string{}, path...)
+	sort.Strings(members)
+	if _, found := closed[strings.Join(members, " ")]; found {
+		return ""
+	}
+	closed[strings.Join(members, " ")] = struct{}{}
+	return key + " -> " + strings.Join(path, " -> ")
+}
+
+// findCycles returns the distinct cycles of blocking links, each as closeCycle writes it.
+func findCycles(issues *map[string]IssueInfo) []string {
+	var cycles []string
+	closed := make(map[string]struct{})
+	for _, key := range sortedKeys(*issues) {
+		for _, blockedKey := range (*issues)[key].blockedKeys {
+			if cycle := closeCycle(issues, key, blockedKey, closed); len(cycle) > 0 {
+				cycles = append(cycles, cycle)
+			}
+		}
+	}
+	return cycles
+}
+
+// shortestPath returns the keys along the shortest chain by which from blocks to,
+// or nil when from doesn't block to.
+func shortestPath(issues *map[string]IssueInfo, from string, to string) []string {
+	previous := map[string]string{from: ""}
+	pending := []string{from}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current == to && current != from {
+			break
+		}
+		for _, blockedKey := range (*issues)[current].blockedKeys {
+			if _, seen := previous[blockedKey]; !seen {
+				previous[blockedKey] = current
+				pending = append(pending, blockedKey)
+			}
+		}
+	}
+	if _, found := previous[to]; !found || from == to {
+		return nil
+	}
+
+	path := []string{to}
+	for key := previous[to]; len(key) > 0; key = previous[key] {
+		path = append([]string{key}, path...)
+	}
+	return path
+}
+
+// allPaths returns every chain without repeated tickets by which from blocks to,
+// up to maxDepth links long, shortest first.
+func allPaths(issues *map[string]IssueInfo, from string, to string, maxDepth int) [][]string {
+	var paths [][]string
+	path := []string{from}
+	onPath := map[string]struct{}{from: {}}
+	var follow func(current string)
+	follow = func(current string) {
+		if len(path) > maxDepth {
+			return
+		}
+		for _, blockedKey := range (*issues)[current].blockedKeys {
+			if _, visited := onPath[blockedKey]; visited {
+				continue
+			}
+			path = append(path, blockedKey)
+			if blockedKey == to {
+				paths = append(paths, append([]string{}, path...))
+			} else {
+				onPath[blockedKey] = struct{}{}
+				follow(blockedKey)
+				delete(onPath, blockedKey)
+			}
+			path = path[:len(path)-1]
+		}
+	}
+	if from != to {
+		follow(from)
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return strings.Join(paths[i], " ") < strings.Join(paths[j], " ")
+	})
+	return paths
+}
+
+// applyKeysFile keeps only the -keysFile tickets, plus their direct links with -keysNeighbors.
+func applyKeysFile(issues *map[string]IssueInfo, options Options) {
+	if len(options.keysFilename) == 0 {
+		return
+	}
+	keep := make(map[string]struct{})
+	for key := range options.fileKeys {
+		issue, found := (*issues)[key]
+		if !found {
+			logEvent(options, "warning", "listed_not_found", map[string]any{"key": key}, "listed ticket not found: "+key)
+			continue
+		}
+		keep[key] = struct{}{}
+		if options.keysNeighbors {
+			for _, linkedKey := range append(append([]string{}, issue.blockerKeys...), issue.blockedKeys...) {
+				keep[linkedKey] = struct{}{}
+			}
+		}
+	}
+	keepIssues(issues, keep)
+}
+
+// duplicateLinkType is the link type Jira uses for "duplicates" and "is duplicated by".
+const duplicateLinkType = "Duplicate"
+
+// mergeDuplicates folds each set of tickets linked as duplicates into one of them, the
+// original that duplicates nothing else when there is one, moving their links onto it.
+func mergeDuplicates(issues *map[string]IssueInfo) {
+	group := make(map[string]string)
+	var find func(key string) string
+	find = func(key string) string {
+		if parent, found := group[key]; found && parent != key {
+			root := find(parent)
+			group[key] = root
+			return root
+		}
+		return key
+	}
+	duplicates := make(map[string]struct{})
+	for _, key := range sortedKeys(*issues) {
+		for _, link := range (*issues)[key].links {
+			_, fromFound := (*issues)[link.from]
+			_, toFound := (*issues)[link.to]
+			if strings.EqualFold(link.linkType, duplicateLinkType) && fromFound && toFound {
+				duplicates[link.from] = struct{}{}
+				fromRoot, toRoot := find(link.from), find(link.to)
+				if fromRoot != toRoot {
+					group[fromRoot] = toRoot
+				}
+			}
+		}
+	}
+
+	// pick each group's original, and where each duplicate goes
+	members := make(map[string][]string)
+	for key := range group {
+		members[find(key)] = append(members[find(key)], key)
+	}
+	rename := make(map[string]string)
+	for _, root := range sortedKeys(members) {
+		keys := append(members[root], root)
+		sort.Strings(keys)
+		original := keys[0]
+		for _, key := range keys {
+			if _, isDuplicate := duplicates[key]; !isDuplicate {
+				original = key
+				break
+			}
+		}
+		for _, key := range keys {
+			if key != original {
+				rename[key] = original
+			}
+		}
+	}
+	if len(rename) == 0 {
+		return
+	}
+
+	for _, key := range sortedKeys(rename) {
+		duplicate, original := (*issues)[key], (*issues)[rename[key]]
+		if !containsKey(&original.duplicateKeys, key) {
+			original.duplicateKeys = append(original.duplicateKeys, key)
+		}
+		merge(&original, &duplicate, issues)
+		delete(*issues, key)
+	}
+	// sorted here rather than by the writers, which run concurrently and only read the issues
+	for _, key := range rename {
+		sort.Strings((*issues)[key].duplicateKeys)
+	}
+	renameReferences(issues, rename)
+}
+
+// renameReferences points every ticket's links at the renamed keys, dropping repeats and links to self.
+func renameReferences(issues *map[string]IssueInfo, rename map[string]string) {
+	for key, issue := range *issues {
+		issue.blockerKeys = renamedKeys(issue.blockerKeys, rename, key)
+		issue.blockedKeys = renamedKeys(issue.blockedKeys, rename, key)
+		issue.blockerCounts = renamedCounts(issue.blockerCounts, rename)
+		issue.blockedCounts = renamedCounts(issue.blockedCounts, rename)
+		var links []Link
+		for _, link := range issue.links {
+			if renamed, found := rename[link.from]; found {
+				link.from = renamed
+			}
+			if renamed, found := rename[link.to]; found {
+				link.to = renamed
+			}
+			if link.from != link.to && !containsLink(links, link) {
+				links = append(links, link)
+			}
+		}
+		issue.links = links
+		(*issues)[key] = issue
+	}
+}
+
+// applyAliases rewrites the old keys of moved or renamed tickets to their current ones,
+// folding any rows under an old key into the current ticket.
+func applyAliases(issues *map[string]IssueInfo, aliases map[string]string, report *Report) {
+	rename := make(map[string]string)
+	for oldKey := range aliases {
+		newKey := aliases[oldKey]
+		for hops := 0; hops < len(aliases); hops++ {
+			if next, moved := aliases[newKey]; moved {
+				newKey = next
+			}
+		}
+		if newKey != oldKey {
+			rename[oldKey] = newKey
+		}
+	}
+	for _, oldKey := range sortedKeys(rename) {
+		old, found := (*issues)[oldKey]
+		if !found {
+			continue
+		}
+		delete(*issues, oldKey)
+		if row, hasRow := report.firstRows[oldKey]; hasRow {
+			if _, found := report.firstRows[rename[oldKey]]; !found {
+				report.firstRows[rename[oldKey]] = row
+			}
+		}
+		if current, found := (*issues)[rename[oldKey]]; found {
+			merge(&current, &old, issues)
+		} else {
+			old.issueKey = rename[oldKey]
+			(*issues)[old.issueKey] = old
+		}
+	}
+	renameReferences(issues, rename)
+}
+
+// renamedKeys replaces renamed keys, dropping repeats and links to self.
+func renamedKeys(keys []string, rename map[string]string, self string) []string {
+	var renamed []string
+	for _, key := range keys {
+		if target, found := rename[key]; found {
+			key = target
+		}
+		if key != self && !containsKey(&renamed, key) {
+			renamed = append(renamed, key)
+		}
+	}
+	return renamed
+}
+
+func renamedCounts(counts map[string]int, rename map[string]string) map[string]int {
+	renamed := make(map[string]int)
+	for key, count := range counts {
+		if target, found := rename[key]; found {
+			key = target
+		}
+		renamed[key] += count
+	}
+	return renamed
+}
+
+// applyProjectHides drops the tickets hidden by their project's config, except -showKeys.
+func applyProjectHides(issues *map[string]IssueInfo, options Options) {
+	if len(options.config.Projects) == 0 {
+		return
+	}
+	keep := make(map[string]struct{})
+	for key, issue := range *issues {
+		project := options.config.Projects[projectKey(key)]
+		hidden := project.Hide
+		for _, status := range project.HideStatuses {
+			hidden = hidden || strings.EqualFold(status, issue.status)
+		}
+		if _, showIt := (options.showKeys)[key]; showIt || !hidden {
+			keep[key] = struct{}{}
+		}
+	}
+	keepIssues(issues, keep)
+}
+
+// applyTeams keeps only the tickets of the -teams teams, and any showKeys.
+func applyTeams(issues *map[string]IssueInfo, options Options) {
+	if len(options.teams) == 0 {
+		return
+	}
+	keep := make(map[string]struct{})
+	for key, issue := range *issues {
+		_, onTeam := options.teams[strings.ToUpper(teamFor(&issue, options.teamMap))]
+		if _, showIt := (options.showKeys)[key]; showIt || onTeam {
+			keep[key] = struct{}{}
+		}
+	}
+	keepIssues(issues, keep)
+}
+
+// applyAllowedProjects drops the tickets of projects a serve request's API key may not see,
+// whatever else the request asked for.
+func applyAllowedProjects(issues *map[string]IssueInfo, options Options) {
+	if len(options.allowedProjects) == 0 {
+		return
+	}
+	keep := make(map[string]struct{})
+	for key := range *issues {
+		if _, allowed := options.allowedProjects[projectKey(key)]; allowed {
+			keep[key] = struct{}{}
+		}
+	}
+	keepIssues(issues, keep)
+}
+
+// keepIssues removes every issue not in keep, along with links to them.
+func keepIssues(issues *map[string]IssueInfo, keep map[string]struct{}) {
+	for key, issue := range *issues {
+		if _, kept := keep[key]; !kept {
+			delete(*issues, key)
+			continue
+		}
+		issue.blockerKeys = keptKeys(issue.blockerKeys, keep)
+		issue.blockedKeys = keptKeys(issue.blockedKeys, keep)
+		(*issues)[key] = issue
+	}
+}
+
+func keptKeys(keys []string, keep map[string]struct{}) []string {
+	var kept []string
+	for _, key := range keys {
+		if _, found := keep[key]; found {
+			kept = append(kept, key)
+		}
+	}
+	return kept
+}
+
+func containsKey(keys *[]string, searchKey string) bool {
+	found := false
+	for _, key := range *keys {
+		if key == searchKey {
+			found = true
+			break
+		}
+	}
+	return found
+}
+
+// writeOutputFile writes the tickets to an output in its format, after its provenance and gzipped if
+// it's compressed.
+func writeOutputFile(issues *map[string]IssueInfo, outFile io.Writer, output Output, options Options) error {
+	writer := outFile
+	var compressed *gzip.Writer
+	if output.compress {
+		compressed = gzip.NewWriter(outFile)
+		writer = compressed
+	}
+	if prefix, found := commentPrefixes[output.format]; found {
+		for _, line := range provenance(options) {
+			_, _ = fmt.Fprintf(writer, "%s%s\n", prefix, line)
+		}
+	}
+	err := writeFormat(issues, writer, output.format, options)
+	if compressed != nil {
+		if closeErr := compressed.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// writeEpicOutputs writes, next to each plantuml, svg or embed output, the parent rollup as NAME-epics.EXT:
+// which epics depend on which through their children's links. Stdout gets it after the detailed diagram.
+func writeEpicOutputs(issues *map[string]IssueInfo, options Options) error {
+	epicOptions := options
+	epicOptions.rollup = "parent"
+	for _, output := range options.outputs {
+		if output.format != "plantuml" && output.format != "svg" && output.format != "embed" {
+			continue
+		}
+		output.filename = suffixFilename(output.filename, "-epics")
+		outFile, err := createOutput(output.filename)
+		if err != nil {
+			return fmt.Errorf("can't create output file (%s): %v", output.filename, err)
+		}
+		err = writeOutputFile(issues, outFile, output, epicOptions)
+		closeOutput(outFile)
+		if err != nil {
+			return fmt.Errorf("output failure (%s): %v", output.filename, err)
+		}
+	}
+	return nil
+}
+
+// suffixFilename inserts a suffix before a filename's extension, and any .gz: with '-epics',
+// deps.puml.gz becomes deps-epics.puml.gz.
+func suffixFilename(filename string, suffix string) string {
+	if filename == "-" {
+		return filename
+	}
+	name, compressed := strings.CutSuffix(filename, ".gz")
+	extension := filepath.Ext(name)
+	name = strings.TrimSuffix(name, extension) + suffix + extension
+	if compressed {
+		name += ".gz"
+	}
+	return name
+}
+
+// writeOutputs writes the outputs of a parse concurrently, each file's in a goroutine of its own,
+// since writers only read the issues. Outputs to stdout are written in turn, so they don't mix.
+func writeOutputs(issues *map[string]IssueInfo, outFiles []io.Writer, options Options) error {
+	options.inputHashes = hashInputs(options)
+	errs := make([]error, len(options.outputs))
+	write := func(i int, output Output) {
+		var err error
+		pageable := output.format == "plantuml" || output.format == "svg" || output.format == "embed"
+		if pageable && options.maxNodes > 0 && len(shownIssues(issues, options)) > options.maxNodes {
+			err = writePages(issues, outFiles[i], output, options)
+		} else {
+			err = writeOutputFile(issues, outFiles[i], output, options)
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("output failure (%s): %v", output.filename, err)
+		}
+	}
+	var writers sync.WaitGroup
+	for i, output := range options.outputs {
+		if output.filename != "-" {
+			writers.Add(1)
+			go func(i int, output Output) {
+				defer writers.Done()
+				write(i, output)
+			}(i, output)
+		}
+	}
+	for i, output := range options.outputs {
+		if output.filename == "-" {
+			write(i, output)
+		}
+	}
+	writers.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePages writes an output showing more than -maxNodes tickets as pages, NAME-page1.EXT on,
+// and an index of them to outFile. Links between pages are only drawn in the index.
+func writePages(issues *map[string]IssueInfo, outFile io.Writer, output Output, options Options) error {
+	pages := pageKeys(issues, shownIssues(issues, options), options.maxNodes)
+	indexOptions := options
+	indexOptions.pages = pages
+	indexOptions.pageFiles = nil
+	for i, keys := range pages {
+		pageOutput := output
+		pageOutput.filename = suffixFilename(output.filename, fmt.Sprintf("-page%d", i+1))
+		indexOptions.pageFiles = append(indexOptions.pageFiles, filepath.Base(pageOutput.filename))
+
+		keep := make(map[string]struct{})
+		for _, key := range keys {
+			keep[key] = struct{}{}
+		}
+		page := make(map[string]IssueInfo)
+		for key, issue := range *issues {
+			page[key] = issue
+		}
+		keepIssues(&page, keep)
+		// tickets whose links all lead to other pages stay shown on theirs
+		pageOptions := options
+		pageOptions.showKeys = keep
+
+		pageFile, err := createOutput(pageOutput.filename)
+		if err != nil {
+			return fmt.Errorf("can't create output file (%s): %v", pageOutput.filename, err)
+		}
+		err = writeOutputFile(&page, pageFile, pageOutput, pageOptions)
+		closeOutput(pageFile)
+		if err != nil {
+			return fmt.Errorf("output failure (%s): %v", pageOutput.filename, err)
+		}
+	}
+	return writeOutputFile(issues, outFile, output, indexOptions)
+}
+
+// pageKeys splits the shown tickets into pages of at most maxNodes, keeping linked tickets together:
+// connected groups of tickets fill the pages first fit, largest first, and groups too big for a
+// page are cut in breadth-first order, so each page holds neighbors.
+func pageKeys(issues *map[string]IssueInfo, shown map[string]struct{}, maxNodes int) [][]string {
+	var groups [][]string
+	seen := make(map[string]struct{})
+	for _, start := range sortedKeys(shown) {
+		if _, done := seen[start]; done {
+			continue
+		}
+		seen[start] = struct{}{}
+		group := []string{start}
+		for i := 0; i < len(group); i++ {
+			issue := (*issues)[group[i]]
+			for _, key := range append(append([]string{}, issue.blockerKeys...), issue.blockedKeys...) {
+				_, isShown := shown[key]
+				if _, done := seen[key]; isShown && !done {
+					seen[key] = struct{}{}
+					group = append(group, key)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return len(groups[i]) > len(groups[j]) })
+
+	var pages [][]string
+	for _, group := range groups {
+		for len(group) > maxNodes {
+			pages = append(pages, group[:maxNodes:maxNodes])
+			group = group[maxNodes:]
+		}
+		placed := false
+		for i := range pages {
+			if len(pages[i])+len(group) <= maxNodes {
+				pages[i] = append(pages[i], group...)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			pages = append(pages, group)
+		}
+	}
+	return pages
+}
+
+// writePageIndex writes the -maxNodes index: an object for each page naming its file and the
+// projects and epics it holds, with the links between pages weighted by their number.
+func writePageIndex(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	output := bufio.NewWriter(outFile)
+
+	// write header
+	err := writeHeader(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	// write each page as an object
+	pageOf := make(map[string]int)
+	parents := parentKeys(issues)
+	for i, keys := range options.pages {
+		projects := make(map[string]int)
+		epics := make(map[string]int)
+		for _, key := range keys {
+			issue := (*issues)[key]
+			pageOf[key] = i
+			projects[projectKey(key)]++
+			if epic := parentGroup(&issue, issues, parents); len(epic) > 0 {
+				epics[epic]++
+			}
+		}
+		_, _ = output.WriteString(fmt.Sprintf("object \"Page %d\" as page%d {\n", i+1, i+1))
+		_, _ = output.WriteString(fmt.Sprintf("  %s\n", options.pageFiles[i]))
+		for _, project := range sortedKeys(projects) {
+			_, _ = output.WriteString(fmt.Sprintf("  project %s: %d\n", project, projects[project]))
+		}
+		for _, epic := range sortedKeys(epics) {
+			_, _ = output.WriteString(fmt.Sprintf("  epic %s: %d\n", epic, epics[epic]))
+		}
+		_, _ = output.WriteString("}\n")
+	}
+	// write each page relationship, weighted by its number of links
+	weights := make(map[[2]int]int)
+	for _, key := range sortedKeys(pageOf) {
+		for _, blockedKey := range (*issues)[key].blockedKeys {
+			if page, found := pageOf[blockedKey]; found && page != pageOf[key] {
+				weights[[2]int{pageOf[key], page}]++
+			}
+		}
+	}
+	for blocker := range options.pages {
+		for blocked := range options.pages {
+			if weight, found := weights[[2]int{blocker, blocked}]; found {
+				_, _ = output.WriteString(fmt.Sprintf("page%d <|-- page%d : %d\n", blocker+1, blocked+1, weight))
+			}
+		}
+	}
+	// write end
+	err = writeFooter(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	err = output.Flush()
+	if err != nil {
+		return fmt.Errorf("couldn't flush: %v\n", err)
+	}
+	return nil
+}
+
+// commentPrefixes start a comment line in the text formats; json and svg carry provenance their own way.
+var commentPrefixes = map[string]string{"plantuml": "' ", "dot": "// ", "mermaid": "%% "}
+
+// provenance describes how an output was produced, so a diagram found on a wiki can be traced back:
+// JiraD's version, when, the inputs with their hashes, and the options in effect.
+func provenance(options Options) []string {
+	lines := []string{fmt.Sprintf("Generated by JiraD %s at %s", version, time.Now().Format(time.RFC3339))}
+	if options.reproducible {
+		lines[0] = "Generated by JiraD " + version
+	}
+	for _, filename := range []string{options.inFilename, options.supplementalFilename} {
+		if len(filename) > 0 {
+			hash, found := options.inputHashes[filename]
+			if !found {
+				hash = fileHash(filename)
+			}
+			lines = append(lines, fmt.Sprintf("Input: %s (sha256 %s)", filename, hash))
+		}
+	}
+	if len(options.settings) > 0 {
+		lines = append(lines, "Options: "+strings.Join(options.settings, " "))
+	}
+	return lines
+}
+
+// fileHash hashes a file as it reads it, so archival exports needn't fit in memory.
+func fileHash(filename string) string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "unreadable"
+	}
+	defer func() { _ = file.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "unreadable"
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// hashInputs hashes the inputs once for the provenance of all of a run's outputs.
+func hashInputs(options Options) map[string]string {
+	hashes := make(map[string]string)
+	for _, filename := range []string{options.inFilename, options.supplementalFilename} {
+		if len(filename) > 0 {
+			hashes[filename] = fileHash(filename)
+		}
+	}
+	return hashes
+}
+
+// writeFormat writes the tickets in one of the outputFormats.
+func writeFormat(issues *map[string]IssueInfo, outFile io.Writer, format string, options Options) error {
+	switch format {
+	case "json":
+		return writeJson(issues, outFile, options)
+	case "dot":
+		return writeDot(issues, outFile, options)
+	case "mermaid":
+		return writeMermaid(issues, outFile, options)
+	case "svg":
+		return writeRendered(issues, outFile, format, options)
+	case "embed":
+		return writeEmbed(issues, outFile, options)
+	case "msproject":
+		return writeMsProject(issues, outFile, options)
+	case "links":
+		return writeLinkList(issues, outFile, options)
+	case "ics":
+		return writeCalendar(issues, outFile, options)
+	}
+	if len(options.pages) > 0 {
+		return writePageIndex(issues, outFile, options)
+	}
+	if len(options.rollup) > 0 {
+		return writeRollup(issues, outFile, options)
+	}
+	return writeOutput(issues, outFile, options)
+}
+
+// outputFormats are the formats -format accepts.
+var outputFormats = []string{"plantuml", "json", "dot", "mermaid", "svg", "embed", "msproject", "links", "ics"}
+
+// formatExtensions maps output file extensions to the format they imply when -format isn't given.
+var formatExtensions = map[string]string{
+	".puml":     "plantuml",
+	".plantuml": "plantuml",
+	".pu":       "plantuml",
+	".wsd":      "plantuml",
+	".json":     "json",
+	".dot":      "dot",
+	".gv":       "dot",
+	".mmd":      "mermaid",
+	".mermaid":  "mermaid",
+	".svg":      "svg",
+	".html":     "embed",
+	".xml":      "msproject",
+	".csv":      "links",
+	".ics":      "ics",
+}
+
+// serverUrl returns the -plantumlServer URL rendering the diagram in format (like svg or png),
+// with its PlantUML text deflate-encoded in the path. It warns when that's the public default
+// server, which then sees the tickets.
+func serverUrl(issues *map[string]IssueInfo, format string, options Options) (string, error) {
+	if !options.plantUmlServerSet {
+		logEvent(options, "warning", "public_server", map[string]any{"server": options.plantUmlServer},
+			"rendering on the public "+options.plantUmlServer+"; set -plantumlServer to keep tickets in house")
+	}
+	var text bytes.Buffer
+	err := writeFormat(issues, &text, "plantuml", options)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := encodePlantUml(text.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode: %v", err)
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(options.plantUmlServer, "/"), format, encoded), nil
+}
+
+// provenanceComment returns the provenance as an HTML or XML comment.
+func provenanceComment(options Options) string {
+	return "<!--\n" + strings.ReplaceAll(strings.Join(provenance(options), "\n"), "--", "- -") + "\n-->\n"
+}
+
+// writeEmbed writes an <img> snippet showing the diagram as rendered by -plantumlServer, for
+// wikis that can't host files.
+func writeEmbed(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	url, err := serverUrl(issues, "svg", options)
+	if err != nil {
+		return err
+	}
+	if len(url) > 8000 {
+		logEvent(options, "warning", "long_url", map[string]any{"length": len(url)},
+			fmt.Sprintf("diagram URL is %d characters long; some servers refuse URLs that long", len(url)))
+	}
+	_, _ = io.WriteString(outFile, provenanceComment(options))
+	_, err = fmt.Fprintf(outFile, "<img src=\"%s\" alt=\"Ticket dependencies\">\n", html.EscapeString(url))
+	return err
+}
+
+// renderTimeout bounds a -plantumlServer request, and renderLimit the size of the diagram it returns.
+const (
+	renderTimeout = 60 * time.Second
+	renderLimit   = 32 << 20
+)
+
+var renderClient = &http.Client{Timeout: renderTimeout}
+
+// writeRendered writes the diagram as rendered by -plantumlServer. Its errors leave out the server's
+// URL, since serve passes them on to clients.
+func writeRendered(issues *map[string]IssueInfo, outFile io.Writer, format string, options Options) error {
+	url, err := serverUrl(issues, format, options)
+	if err != nil {
+		return err
+	}
+	response, err := renderClient.Get(url)
+	if err != nil {
+		// the request's *url.Error names the URL, so only its cause is told
+		var requestErr interface{ Unwrap() error }
+		if errors.As(err, &requestErr) {
+			err = requestErr.Unwrap()
+		}
+		return fmt.Errorf("couldn't render: %v", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't render: PlantUML server answered %s", response.Status)
+	}
+	rendered, err := io.ReadAll(io.LimitReader(response.Body, renderLimit+1))
+	if err != nil {
+		return fmt.Errorf("couldn't render: %v", err)
+	}
+	if len(rendered) > renderLimit {
+		return fmt.Errorf("couldn't render: diagram larger than %d MB", renderLimit>>20)
+	}
+
+	// the provenance comment goes after any XML declaration, which has to come first
+	comment := provenanceComment(options)
+	declarationEnd := 0
+	if bytes.HasPrefix(rendered, []byte("<?xml")) {
+		declarationEnd = bytes.Index(rendered, []byte("?>")) + len("?>")
+	}
+	_, _ = outFile.Write(rendered[:declarationEnd])
+	_, _ = io.WriteString(outFile, comment)
+	_, err = outFile.Write(rendered[declarationEnd:])
+	return err
+}
+
+// jsonTicket is a ticket as written by -format json.
+type jsonTicket struct {
+	Key            string   `json:"key"`
+	Summary        string   `json:"summary,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Status         string   `json:"status,omitempty"`
+	StatusCategory string   `json:"statusCategory,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	Priority       string   `json:"priority,omitempty"`
+	Points         float64  `json:"points,omitempty"`
+	Team           string   `json:"team,omitempty"`
+	Assignee       string   `json:"assignee,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	Sprints        []string `json:"sprints,omitempty"`
+	Badges         []string `json:"badges,omitempty"`
+	Parent         string   `json:"parent,omitempty"`
+	Duplicates     []string `json:"duplicates,omitempty"`
+	Blocks         []string `json:"blocks,omitempty"`
+	BlockedBy      []string `json:"blockedBy,omitempty"`
+	Due            string   `json:"due,omitempty"`
+	Created        string   `json:"created,omitempty"`
+	Updated        string   `json:"updated,omitempty"`
+	Impact         *int     `json:"impact,omitempty"`
+	Slack          *int     `json:"slack,omitempty"`
+	Centrality     *float64 `json:"centrality,omitempty"`
+}
+
+// newJsonTicket fills in a ticket's parsed fields, for -format json and the detail card alike.
+func newJsonTicket(key string, issue *IssueInfo, options Options) jsonTicket {
+	ticket := jsonTicket{
+		Key:            key,
+		Summary:        issue.summary,
+		Description:    issue.description,
+		Status:         issue.status,
+		StatusCategory: statusCategory(issue, options),
+		Type:           issue.issueType,
+		Priority:       issue.priority,
+		Points:         issue.points,
+		Team:           issue.team,
+		Assignee:       issue.assignee,
+		Labels:         issue.labels,
+		Sprints:        issue.sprints,
+		Badges:         issue.badges,
+		Parent:         issue.parent,
+		Duplicates:     issue.duplicateKeys,
+		Blocks:         issue.blockedKeys,
+		BlockedBy:      issue.blockerKeys,
+	}
+	if !issue.due.IsZero() {
+		ticket.Due = issue.due.Format(time.DateOnly)
+	}
+	if !issue.created.IsZero() {
+		ticket.Created = issue.created.Format(time.DateOnly)
+	}
+	if !issue.updated.IsZero() {
+		ticket.Updated = issue.updated.Format(time.DateOnly)
+	}
+	return ticket
+}
+
+type jsonLink struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// writeJson writes the shown tickets and their links as a JSON graph, with -showImpact
+// and -metrics scores when computed.
+func writeJson(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	shown := shownIssues(issues, options)
+	graph := struct {
+		Provenance []string     `json:"provenance"`
+		Tickets    []jsonTicket `json:"tickets"`
+		Links      []jsonLink   `json:"links,omitempty"`
+	}{Provenance: provenance(options), Tickets: []jsonTicket{}}
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		ticket := newJsonTicket(key, &issue, options)
+		ticket.Blocks = keptKeys(issue.blockedKeys, shown)
+		ticket.BlockedBy = keptKeys(issue.blockerKeys, shown)
+		if options.showImpact {
+			impact := issue.impact
+			ticket.Impact = &impact
+		}
+		if options.showSlack && issue.scheduled {
+			slack := issue.slack
+			ticket.Slack = &slack
+		}
+		if len(options.metrics) > 0 {
+			centrality := issue.centrality
+			ticket.Centrality = &centrality
+		}
+		graph.Tickets = append(graph.Tickets, ticket)
+		for _, link := range issue.links {
+			_, fromShown := shown[link.from]
+			_, toShown := shown[link.to]
+			if fromShown && toShown && !containsJsonLink(graph.Links, link) {
+				graph.Links = append(graph.Links, jsonLink{Type: link.linkType, From: link.from, To: link.to})
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode: %v", err)
+	}
+	_, err = outFile.Write(append(data, '\n'))
+	return err
+}
+
+func containsJsonLink(links []jsonLink, link Link) bool {
+	for _, existing := range links {
+		if existing.Type == link.linkType && existing.From == link.from && existing.To == link.to {
+			return true
+		}
+	}
+	return false
+}
+
+// plantUmlColors are the color names PlantUML knows: the web colors and its ArchiMate ones.
+var plantUmlColors = []string{"AliceBlue", "AntiqueWhite", "Aqua", "Aquamarine", "Azure", "Beige", "Bisque",
+	"Black", "BlanchedAlmond", "Blue", "BlueViolet", "Brown", "BurlyWood", "CadetBlue", "Chartreuse", "Chocolate",
+	"Coral", "CornflowerBlue", "Cornsilk", "Crimson", "Cyan", "DarkBlue", "DarkCyan", "DarkGoldenRod", "DarkGray",
+	"DarkGreen", "DarkGrey", "DarkKhaki", "DarkMagenta", "DarkOliveGreen", "DarkOrchid", "DarkRed", "DarkSalmon",
+	"DarkSeaGreen", "DarkSlateBlue", "DarkSlateGray", "DarkSlateGrey", "DarkTurquoise", "DarkViolet", "Darkorange",
+	"DeepPink", "DeepSkyBlue", "DimGray", "DimGrey", "DodgerBlue", "FireBrick", "FloralWhite", "ForestGreen",
+	"Fuchsia", "Gainsboro", "GhostWhite", "Gold", "GoldenRod", "Gray", "Green", "GreenYellow", "Grey", "HoneyDew",
+	"HotPink", "IndianRed", "Indigo", "Ivory", "Khaki", "Lavender", "LavenderBlush", "LawnGreen", "LemonChiffon",
+	"LightBlue", "LightCoral", "LightCyan", "LightGoldenRodYellow", "LightGray", "LightGreen", "LightGrey",
+	"LightPink", "LightSalmon", "LightSeaGreen", "LightSkyBlue", "LightSlateGray", "LightSlateGrey",
+	"LightSteelBlue", "LightYellow", "Lime", "LimeGreen", "Linen", "Magenta", "Maroon", "MediumAquaMarine",
+	"MediumBlue", "MediumOrchid", "MediumPurple", "MediumSeaGreen", "MediumSlateBlue", "MediumSpringGreen",
+	"MediumTurquoise", "MediumVioletRed", "MidnightBlue", "MintCream", "MistyRose", "Moccasin", "NavajoWhite",
+	"Navy", "OldLace", "Olive", "OliveDrab", "Orange", "OrangeRed", "Orchid", "PaleGoldenRod", "PaleGreen",
+	"PaleTurquoise", "PaleVioletRed", "PapayaWhip", "PeachPuff", "Peru", "Pink", "Plum", "PowderBlue", "Purple",
+	"Red", "RosyBrown", "RoyalBlue", "SaddleBrown", "Salmon", "SandyBrown", "SeaGreen", "SeaShell", "Sienna",
+	"Silver", "SkyBlue", "SlateBlue", "SlateGray", "SlateGrey", "Snow", "SpringGreen", "SteelBlue", "Tan", "Teal",
+	"Thistle", "Tomato", "Turquoise", "Violet", "Wheat", "White", "WhiteSmoke", "Yellow", "YellowGreen",
+	"Application", "Business", "Implementation", "Motivation", "Physical", "Strategy", "Technology", "Transparent"}
+
+// validateColors checks every color option and config color, so mistakes fail the run
+// before PlantUML rejects the diagram.
+func validateColors(options Options) error {
+	check := func(name string, color string) error {
+		if len(color) == 0 || isColor(color) {
+			return nil
+		}
+		if suggestion := closestColor(color); len(suggestion) > 0 {
+			return fmt.Errorf("unknown %s color '%s', did you mean '%s'?", name, color, suggestion)
+		}
+		return fmt.Errorf("unknown %s color '%s': use a PlantUML color name or #RRGGBB", name, color)
+	}
+	colors := [][2]string{{"highlightColor", options.highlightColor}}
+	for _, key := range sortedKeys(options.highlightKeyColors) {
+		colors = append(colors, [2]string{"highlightKeys " + key, options.highlightKeyColors[key]})
+	}
+	for _, assignee := range sortedKeys(options.highlightAssignees) {
+		colors = append(colors, [2]string{"highlightAssignee", options.highlightAssignees[assignee]})
+	}
+	for _, label := range sortedKeys(options.highlightLabels) {
+		colors = append(colors, [2]string{"highlightLabel", options.highlightLabels[label]})
+	}
+	for _, color := range options.ageColors {
+		colors = append(colors, [2]string{"ageColors", color})
+	}
+	for _, project := range sortedKeys(options.config.Projects) {
+		colors = append(colors, [2]string{"project " + project, options.config.Projects[project].Color})
+	}
+	palette := options.palette
+	for _, color := range append([]string{palette.Background, palette.Node, palette.Border, palette.Font, palette.Edge,
+		palette.Highlight}, palette.Groups...) {
+		colors = append(colors, [2]string{"palette", color})
+	}
+	for _, category := range sortedKeys(palette.Statuses) {
+		colors = append(colors, [2]string{"palette", palette.Statuses[category]})
+	}
+	for _, color := range colors {
+		if err := check(color[0], color[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isColor reports whether PlantUML takes a color: a name or hex color, with or without '#', or a
+// gradient of two such colors like "#Red-Blue".
+func isColor(color string) bool {
+	color = strings.TrimPrefix(color, "#")
+	if _, err := strconv.ParseUint(color, 16, 32); err == nil && (len(color) == 3 || len(color) == 6 || len(color) == 8) {
+		return true
+	}
+	for _, name := range plantUmlColors {
+		if strings.EqualFold(name, color) {
+			return true
+		}
+	}
+	if i := strings.IndexAny(color, "-|/\\"); i > 0 {
+		return isColor(color[:i]) && isColor(color[i+1:])
+	}
+	return false
+}
+
+// closestColor returns the PlantUML color name nearest a mistyped one, or "" when none is close.
+func closestColor(color string) string {
+	closest, best := "", 4
+	for _, name := range plantUmlColors {
+		if distance := editDistance(strings.ToLower(strings.TrimPrefix(color, "#")), strings.ToLower(name)); distance < best {
+			closest, best = name, distance
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between two strings, in runes.
+func editDistance(a string, b string) int {
+	from, to := []rune(a), []rune(b)
+	previous := make([]int, len(to)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(from); i++ {
+		current := make([]int, len(to)+1)
+		current[0] = i
+		for j := 1; j <= len(to); j++ {
+			cost := 1
+			if from[i-1] == to[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(to)]
+}
+
+// graphColor turns a node's PlantUML color into one Graphviz and Mermaid accept: hex colors keep
+// their '#', and color names (which PlantUML, Graphviz and CSS mostly share) lose it.
+func graphColor(color string) string {
+	name := strings.TrimPrefix(color, "#")
+	if _, err := strconv.ParseUint(name, 16, 32); err == nil && (len(name) == 6 || len(name) == 3) {
+		return "#" + name
+	}
+	return strings.ToLower(name)
+}
+
+// nodeLines returns the text a ticket's node shows in DOT and Mermaid output.
+func nodeLines(issue *IssueInfo, options Options) []string {
+	lines := []string{strings.Join(append([]string{issue.issueKey}, issue.badges...), " "),
+		statusIcon(issue, options) + strings.ToUpper(effectiveStatus(issue))}
+	if options.showImpact {
+		lines = append(lines, fmt.Sprintf("impact: %d open", issue.impact))
+	}
+	if options.showSlack && issue.scheduled {
+		lines = append(lines, fmt.Sprintf("slack: %dd", issue.slack))
+	}
+	if options.showAge && !issue.created.IsZero() {
+		lines = append(lines, fmt.Sprintf("opened %dd ago", daysSince(issue.created, options)))
+	}
+	if isStale(issue, options) {
+		lines = append(lines, fmt.Sprintf("untouched %dd", daysSince(issue.updated, options)))
+	}
+	if !options.hideSummary && len(issue.summary) > 0 {
+		lines = append(lines, wrapWide(issue.summary, options.wrapWidth/pixelsPerColumn)...)
+	}
+	return lines
+}
+
+// writeLinkList writes the resolved blocking links between shown tickets as CSV, one
+// 'ABC-1,Blocks,ABC-2' row per link, for Jira bulk link imports or scripts creating them.
+func writeLinkList(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	shown := shownIssues(issues, options)
+	output := csv.NewWriter(outFile)
+	_ = output.Write([]string{"Issue key", "Link type", "Linked issue key"})
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		for _, blockedKey := range keptKeys(issue.blockedKeys, shown) {
+			if _, chained := issue.chainedKeys[blockedKey]; !chained {
+				_ = output.Write([]string{key, "Blocks", blockedKey})
+			}
+		}
+	}
+	output.Flush()
+	return output.Error()
+}
+
+// writeCalendar writes the due date of each shown ticket having one as an all-day iCalendar
+// event, noting what blocks it and what it blocks, so chains picked with -roots can be subscribed to.
+func writeCalendar(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	shown := shownIssues(issues, options)
+	escape := strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\n", "\\n")
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	var lines []string
+	lines = append(lines, "BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//JiraD//JiraD "+version+"//EN", "CALSCALE:GREGORIAN")
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		if issue.due.IsZero() {
+			continue
+		}
+		if options.reproducible {
+			stamp = issue.due.Format("20060102T150405Z")
+		}
+		summary := key + " due"
+		if len(issue.summary) > 0 {
+			summary = key + " due: " + issue.summary
+		}
+		description := strings.ToUpper(effectiveStatus(&issue))
+		if blockers := keptKeys(issue.blockerKeys, shown); len(blockers) > 0 {
+			description += "\nBlocked by: " + strings.Join(blockers, ", ")
+		}
+		if blocked := keptKeys(issue.blockedKeys, shown); len(blocked) > 0 {
+			description += "\nBlocks: " + strings.Join(blocked, ", ")
+		}
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+key+"@jirad", "DTSTAMP:"+stamp,
+			"DTSTART;VALUE=DATE:"+issue.due.Format("20060102"), "DTEND;VALUE=DATE:"+issue.due.AddDate(0, 0, 1).Format("20060102"),
+			"SUMMARY:"+escape.Replace(summary), "DESCRIPTION:"+escape.Replace(description), "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	output := bufio.NewWriter(outFile)
+	for _, line := range lines {
+		// lines longer than 75 octets are folded, continuing with a space, without splitting characters
+		for len(line) > 75 {
+			cut := 75
+			for !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			_, _ = output.WriteString(line[:cut] + "\r\n ")
+			line = line[cut:]
+		}
+		_, _ = output.WriteString(line + "\r\n")
+	}
+	return output.Flush()
+}
+
+// msProjectTask is a task of Microsoft Project's XML format. Durations are 8-hour days.
+type msProjectTask struct {
+	UID             int                    `xml:"UID"`
+	ID              int                    `xml:"ID"`
+	Name            string                 `xml:"Name"`
+	Duration        string                 `xml:"Duration"`
+	PercentComplete int                    `xml:"PercentComplete"`
+	Deadline        string                 `xml:"Deadline,omitempty"`
+	Predecessors    []msProjectPredecessor `xml:"PredecessorLink"`
+}
+
+// msProjectPredecessor is a dependency on another task; Type 1 is finish-to-start.
+type msProjectPredecessor struct {
+	PredecessorUID int `xml:"PredecessorUID"`
+	Type           int `xml:"Type"`
+}
+
+type msProjectResource struct {
+	UID  int    `xml:"UID"`
+	ID   int    `xml:"ID"`
+	Name string `xml:"Name"`
+}
+
+type msProjectAssignment struct {
+	UID         int `xml:"UID"`
+	TaskUID     int `xml:"TaskUID"`
+	ResourceUID int `xml:"ResourceUID"`
+}
+
+// writeMsProject writes the shown tickets as Microsoft Project XML: a task per ticket lasting
+// its estimatedDays, finish-to-start dependencies from its blockers, and its assignee as resource.
+func writeMsProject(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	shown := shownIssues(issues, options)
+	keys := sortedKeys(shown)
+	uids := make(map[string]int)
+	for i, key := range keys {
+		uids[key] = i + 1
+	}
+	project := struct {
+		XMLName     xml.Name              `xml:"http://schemas.microsoft.com/project Project"`
+		Name        string                `xml:"Name"`
+		StartDate   string                `xml:"StartDate,omitempty"`
+		Tasks       []msProjectTask       `xml:"Tasks>Task"`
+		Resources   []msProjectResource   `xml:"Resources>Resource"`
+		Assignments []msProjectAssignment `xml:"Assignments>Assignment"`
+	}{Name: "Ticket dependencies"}
+	if !options.reproducible {
+		project.StartDate = time.Now().Format(time.DateOnly) + "T08:00:00"
+	}
+	resources := make(map[string]int)
+	for _, key := range keys {
+		issue := (*issues)[key]
+		task := msProjectTask{UID: uids[key], ID: uids[key], Name: key,
+			Duration: fmt.Sprintf("PT%dH0M0S", 8*estimatedDays(&issue, options))}
+		if len(issue.summary) > 0 {
+			task.Name += " " + issue.summary
+		}
+		if isDone(&issue, options) {
+			task.PercentComplete = 100
+		}
+		if !issue.due.IsZero() {
+			task.Deadline = issue.due.Format(time.DateOnly) + "T17:00:00"
+		}
+		for _, blockerKey := range keptKeys(issue.blockerKeys, shown) {
+			task.Predecessors = append(task.Predecessors, msProjectPredecessor{PredecessorUID: uids[blockerKey], Type: 1})
+		}
+		project.Tasks = append(project.Tasks, task)
+		if len(issue.assignee) == 0 {
+			continue
+		}
+		if _, found := resources[issue.assignee]; !found {
+			resources[issue.assignee] = len(resources) + 1
+			project.Resources = append(project.Resources, msProjectResource{UID: len(resources), ID: len(resources),
+				Name: issue.assignee})
+		}
+		project.Assignments = append(project.Assignments, msProjectAssignment{UID: len(project.Assignments) + 1,
+			TaskUID: uids[key], ResourceUID: resources[issue.assignee]})
+	}
+
+	data, err := xml.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode: %v", err)
+	}
+	_, _ = io.WriteString(outFile, xml.Header)
+	_, _ = io.WriteString(outFile, provenanceComment(options))
+	_, err = fmt.Fprintf(outFile, "%s\n", data)
+	return err
+}
+
+// writeDot writes the shown tickets as a Graphviz digraph, with arrows from blocker to blocked.
+func writeDot(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	output := bufio.NewWriter(outFile)
+	shown := shownIssues(issues, options)
+	highestCentrality := 0.0
+	for _, issue := range *issues {
+		highestCentrality = math.Max(highestCentrality, issue.centrality)
+	}
+	escape := strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+	quote := func(text string) string {
+		return "\"" + escape.Replace(text) + "\""
+	}
+
+	_, _ = output.WriteString("digraph JiraD {\n  node [shape=box];\n")
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		var lines []string
+		for _, line := range nodeLines(&issue, options) {
+			lines = append(lines, escape.Replace(line))
+		}
+		attributes := "label=\"" + strings.Join(lines, "\\n") + "\""
+		if tip := tooltip(&issue, options); len(tip) > 0 {
+			attributes += ", tooltip=" + quote(tip)
+		}
+		if color := nodeColor(&issue, highestCentrality, options); len(color) > 0 {
+			attributes += fmt.Sprintf(", style=filled, fillcolor=%s", quote(graphColor(color)))
+		}
+		_, _ = output.WriteString(fmt.Sprintf("  %s [%s];\n", quote(key), attributes))
+	}
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		for _, blockedKey := range keptKeys(issue.blockedKeys, shown) {
+			if hidden, chained := issue.chainedKeys[blockedKey]; chained {
+				_, _ = output.WriteString(fmt.Sprintf("  %s -> %s [style=dashed, label=\"… %d\"];\n", quote(key),
+					quote(blockedKey), hidden))
+			} else if options.edgeColorByBlocker && isDone(&issue, options) {
+				_, _ = output.WriteString(fmt.Sprintf("  %s -> %s [color=gray];\n", quote(key), quote(blockedKey)))
+			} else if options.edgeColorByBlocker {
+				_, _ = output.WriteString(fmt.Sprintf("  %s -> %s [color=red, penwidth=2];\n", quote(key), quote(blockedKey)))
+			} else {
+				_, _ = output.WriteString(fmt.Sprintf("  %s -> %s;\n", quote(key), quote(blockedKey)))
+			}
+		}
+		if _, parentShown := shown[issue.parent]; options.parentLinks && parentShown {
+			_, _ = output.WriteString(fmt.Sprintf("  %s -> %s [style=dotted, arrowhead=none];\n", quote(issue.parent),
+				quote(key)))
+		}
+	}
+	for _, link := range shownLinks(issues, shown) {
+		_, _ = output.WriteString(fmt.Sprintf("  %s -> %s [style=dashed, color=gray, label=%s];\n", quote(link.from),
+			quote(link.to), quote(link.linkType)))
+	}
+	_, _ = output.WriteString("}\n")
+
+	err := output.Flush()
+	if err != nil {
+		return fmt.Errorf("couldn't flush: %v", err)
+	}
+	return nil
+}
+
+// writeMermaid writes the shown tickets as a Mermaid flowchart, with arrows from blocker to blocked.
+func writeMermaid(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	output := bufio.NewWriter(outFile)
+	options.aliases = keyAliases(issues, options)
+	shown := shownIssues(issues, options)
+	highestCentrality := 0.0
+	for _, issue := range *issues {
+		highestCentrality = math.Max(highestCentrality, issue.centrality)
+	}
+	escape := strings.NewReplacer("\"", "#quot;", "<", "#lt;", ">", "#gt;")
+
+	_, _ = output.WriteString("flowchart TB\n")
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		var lines []string
+		for _, line := range nodeLines(&issue, options) {
+			lines = append(lines, escape.Replace(line))
+		}
+		_, _ = output.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", keyAlias(key, options), strings.Join(lines, "<br/>")))
+		if color := nodeColor(&issue, highestCentrality, options); len(color) > 0 {
+			_, _ = output.WriteString(fmt.Sprintf("  style %s fill:%s\n", keyAlias(key, options), graphColor(color)))
+		}
+	}
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		for _, blockedKey := range keptKeys(issue.blockedKeys, shown) {
+			if hidden, chained := issue.chainedKeys[blockedKey]; chained {
+				_, _ = output.WriteString(fmt.Sprintf("  %s -. \"… %d\" .-> %s\n", keyAlias(key, options), hidden,
+					keyAlias(blockedKey, options)))
+			} else {
+				_, _ = output.WriteString(fmt.Sprintf("  %s --> %s\n", keyAlias(key, options), keyAlias(blockedKey, options)))
+			}
+		}
+		if _, parentShown := shown[issue.parent]; options.parentLinks && parentShown {
+			_, _ = output.WriteString(fmt.Sprintf("  %s --- %s\n", keyAlias(issue.parent, options), keyAlias(key, options)))
+		}
+	}
+	for _, link := range shownLinks(issues, shown) {
+		_, _ = output.WriteString(fmt.Sprintf("  %s -. %s .-> %s\n", keyAlias(link.from, options), escape.Replace(link.linkType),
+			keyAlias(link.to, options)))
+	}
+
+	err := output.Flush()
+	if err != nil {
+		return fmt.Errorf("couldn't flush: %v", err)
+	}
+	return nil
+}
+
+// shownLinks returns the -linkTypes links between shown tickets, in order.
+func shownLinks(issues *map[string]IssueInfo, shown map[string]struct{}) []Link {
+	var links []Link
+	for _, key := range sortedKeys(*issues) {
+		for _, link := range (*issues)[key].links {
+			_, fromShown := shown[link.from]
+			_, toShown := shown[link.to]
+			if fromShown && toShown && !containsLink(links, link) {
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+func writeOutput(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	output := bufio.NewWriter(outFile)
+	options.aliases = keyAliases(issues, options)
+	highestCentrality := 0.0
+	for _, issue := range *issues {
+		highestCentrality = math.Max(highestCentrality, issue.centrality)
+	}
+
+	// write header
+	err := writeHeader(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	// write each issue as an object, grouped into packages by project config
+	sprintNames := sortedSprints(issues)
+	sprintOrder := make(map[string]int)
+	for i, sprint := range sprintNames {
+		sprintOrder[sprint] = i
+	}
+	sprintNames = append(sprintNames, "Backlog")
+	groups := make(map[string][]IssueInfo)
+	shown := make(map[string]struct{})
+	parents := parentKeys(issues)
+	for _, key := range sortedKeys(*issues) {
+		issue := (*issues)[key]
+		if isShown(&issue, parents, options) {
+			group := options.config.Projects[projectKey(issue.issueKey)].Group
+			if options.groupByTeam {
+				group = teamFor(&issue, options.teamMap)
+			}
+			if parent := parentGroup(&issue, issues, parents); options.groupByParent && len(parent) > 0 {
+				group = parent
+			}
+			if site := siteOf(issue.issueKey); len(site) > 0 && len(group) > 0 {
+				group = site + " / " + group
+			} else if len(site) > 0 {
+				group = site
+			}
+			if options.layout == "sprints" {
+				group = sprintNames[sprintIndex(&issue, sprintOrder)]
+			}
+			if options.layout == "statusLanes" {
+				group = statusLane(&issue, options)
+			}
+			groups[group] = append(groups[group], issue)
+			shown[issue.issueKey] = struct{}{}
+		}
+	}
+	writeObjects(output, groups[""], "", highestCentrality, options)
+	order := sortedKeys(groups)
+	if options.layout == "sprints" {
+		order = sprintNames
+	}
+	if options.layout == "statusLanes" {
+		order = laneOrder(order)
+	}
+	colored := 0
+	for _, group := range order {
+		if len(groups[group]) > 0 && len(group) > 0 {
+			color := ""
+			if len(options.palette.Groups) > 0 {
+				color = " #" + strings.TrimPrefix(options.palette.Groups[colored%len(options.palette.Groups)], "#")
+				colored++
+			}
+			_, _ = output.WriteString(fmt.Sprintf("package \"%s\"%s {\n", group, color))
+			writeObjects(output, groups[group], "  ", highestCentrality, options)
+			_, _ = output.WriteString("}\n")
+		}
+	}
+	if options.layout == "statusLanes" {
+		// hidden links between the lanes' first tickets line the lanes up left to right
+		previous := ""
+		for _, lane := range order {
+			if len(groups[lane]) > 0 {
+				if len(previous) > 0 {
+					_, _ = output.WriteString(fmt.Sprintf("%s -[hidden]right- %s\n", keyAlias(previous, options),
+						keyAlias(groups[lane][0].issueKey, options)))
+				}
+				previous = groups[lane][0].issueKey
+			}
+		}
 	}
 	// write each relationship
+	for _, key := range sortedKeys(*issues) {
+		issue := (*issues)[key]
+		for _, blockedKey := range issue.blockedKeys {
+			if hidden, chained := issue.chainedKeys[blockedKey]; chained {
+				_, _ = output.WriteString(fmt.Sprintf("%s <|.. %s : … %d\n", keyAlias(issue.issueKey, options),
+					keyAlias(blockedKey, options), hidden))
+				continue
+			}
+			arrow := "<|--"
+			if options.edgeColorByBlocker && isDone(&issue, options) {
+				arrow = "<|-[#gray]-"
+			} else if options.edgeColorByBlocker {
+				arrow = "<|-[#red,bold]-"
+			}
+			if isNew(issue.issueKey+" "+blockedKey, options) {
+				arrow = fmt.Sprintf("<|-[#%s]-", strings.TrimPrefix(options.highlightColor, "#"))
+			}
+			label := ""
+			count := issue.blockedCounts[blockedKey] + (*issues)[blockedKey].blockerCounts[issue.issueKey]
+			if options.linkCounts && count > 1 {
+				label = fmt.Sprintf(" : ×%d", count)
+			}
+			blocked := (*issues)[blockedKey]
+			if options.layout == "sprints" && !isDone(&issue, options) &&
+				sprintIndex(&issue, sprintOrder) > sprintIndex(&blocked, sprintOrder) {
+				arrow = "<|-[#red,bold]-"
+				label = " : backwards"
+			}
+			_, _ = output.WriteString(fmt.Sprintf("%s %s %s%s\n", keyAlias(issue.issueKey, options), arrow, keyAlias(blockedKey, options), label))
+		}
+	}
+	if options.parentLinks {
+		writeParentLinks(output, issues, shown, options)
+	}
+	writeLinks(output, issues, shown, options)
+	writeRanks(output, issues, shown, options)
+	// write end
+	err = writeFooter(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	err = output.Flush()
+	if err != nil {
+		return fmt.Errorf("couldn't flush: %v\n", err)
+	}
+	return nil
+}
+
+// writeObjects writes a group's tickets, with those of each -together set that share the group
+// inside a together block. A ticket in several sets goes with the first.
+func writeObjects(output *bufio.Writer, issues []IssueInfo, indent string, highestCentrality float64, options Options) {
+	placed := make(map[string]struct{})
+	for _, keys := range options.together {
+		var members []IssueInfo
+		for _, issue := range issues {
+			_, chosen := keys[issue.issueKey]
+			if _, done := placed[issue.issueKey]; chosen && !done {
+				members = append(members, issue)
+			}
+		}
+		if len(members) < 2 {
+			continue
+		}
+		_, _ = output.WriteString(indent + "together {\n")
+		for _, issue := range members {
+			writeObject(output, &issue, indent+"  ", highestCentrality, options)
+			placed[issue.issueKey] = struct{}{}
+		}
+		_, _ = output.WriteString(indent + "}\n")
+	}
+	for _, issue := range issues {
+		if _, done := placed[issue.issueKey]; !done {
+			writeObject(output, &issue, indent, highestCentrality, options)
+		}
+	}
+}
+
+// writeRanks writes the hidden edges of -rankBy, from the first ticket of each rank to all
+// tickets of the next, so ranks stack top to bottom: earliest due date or highest priority
+// first. Tickets without due dates aren't ranked by due date.
+func writeRanks(output *bufio.Writer, issues *map[string]IssueInfo, shown map[string]struct{}, options Options) {
+	ranks := make(map[float64][]string)
+	for _, key := range sortedKeys(shown) {
+		issue := (*issues)[key]
+		switch options.rankBy {
+		case "due":
+			if !issue.due.IsZero() {
+				ranks[float64(issue.due.Unix())] = append(ranks[float64(issue.due.Unix())], key)
+			}
+		case "priority":
+			weight, found := priorityWeights[strings.ToUpper(issue.priority)]
+			if !found {
+				weight = priorityWeights["MEDIUM"]
+			}
+			ranks[-weight] = append(ranks[-weight], key)
+		}
+	}
+	var order []float64
+	for rank := range ranks {
+		order = append(order, rank)
+	}
+	sort.Float64s(order)
+	for i := 1; i < len(order); i++ {
+		for _, key := range ranks[order[i]] {
+			_, _ = output.WriteString(fmt.Sprintf("%s -[hidden]- %s\n", keyAlias(ranks[order[i-1]][0], options), keyAlias(key, options)))
+		}
+	}
+}
+
+// statusLanes are the -layout statusLanes packages, in order; other status categories follow.
+var statusLanes = []string{"No Status", "To Do", "In Progress", "Done"}
+
+// statusLane returns the lane of a ticket: its status category, spelled as in statusLanes
+// when it's one of them.
+func statusLane(issue *IssueInfo, options Options) string {
+	category := statusCategory(issue, options)
+	if len(category) == 0 {
+		return statusLanes[0]
+	}
+	for _, lane := range statusLanes {
+		if strings.EqualFold(lane, category) {
+			return lane
+		}
+	}
+	return category
+}
+
+// laneOrder orders groups by statusLanes, followed by the other groups as given.
+func laneOrder(groups []string) []string {
+	order := append([]string{}, statusLanes...)
+	for _, group := range groups {
+		if !containsKey(&order, group) {
+			order = append(order, group)
+		}
+	}
+	return order
+}
+
+// sortedSprints returns the sprints of the tickets in chronological order, taken to be
+// their names' order with numbers compared by value, so 'Sprint 9' comes before 'Sprint 10'.
+func sortedSprints(issues *map[string]IssueInfo) []string {
+	found := make(map[string]struct{})
 	for _, issue := range *issues {
-		for _, blockedKey := range issue.blockedKeys {
-			_, _ = output.WriteString(fmt.Sprintf("%s <|-- %s\n", normalizeKey(issue.issueKey), normalizeKey(blockedKey)))
+		for _, sprint := range issue.sprints {
+			found[sprint] = struct{}{}
 		}
 	}
-	// write end
-	_, _ = output.WriteString("@enduml\n")
+	sprints := sortedKeys(found)
+	sort.SliceStable(sprints, func(i, j int) bool { return naturalLess(sprints[i], sprints[j]) })
+	return sprints
+}
 
-	err = output.Flush()
+// sprintIndex returns the position in order of the latest sprint a ticket was in, or
+// len(order), the backlog, when it was in none.
+func sprintIndex(issue *IssueInfo, order map[string]int) int {
+	if len(issue.sprints) == 0 {
+		return len(order)
+	}
+	latest := 0
+	for _, sprint := range issue.sprints {
+		latest = max(latest, order[sprint])
+	}
+	return latest
+}
+
+// naturalLess compares strings with their runs of digits compared as numbers.
+func naturalLess(a string, b string) bool {
+	for len(a) > 0 && len(b) > 0 {
+		aDigits := len(a) - len(strings.TrimLeft(a, "0123456789"))
+		bDigits := len(b) - len(strings.TrimLeft(b, "0123456789"))
+		if aDigits > 0 && bDigits > 0 {
+			aNumber := strings.TrimLeft(a[:aDigits], "0")
+			bNumber := strings.TrimLeft(b[:bDigits], "0")
+			if len(aNumber) != len(bNumber) {
+				return len(aNumber) < len(bNumber)
+			}
+			if aNumber != bNumber {
+				return aNumber < bNumber
+			}
+			a, b = a[aDigits:], b[bDigits:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// writeParentLinks draws each shown parent's children as parts of it.
+func writeParentLinks(output *bufio.Writer, issues *map[string]IssueInfo, shown map[string]struct{}, options Options) {
+	for _, key := range sortedKeys(*issues) {
+		parentKey := (*issues)[key].parent
+		_, parentShown := shown[parentKey]
+		_, childShown := shown[key]
+		if parentShown && childShown {
+			_, _ = output.WriteString(fmt.Sprintf("%s *-[#gray]- %s\n", keyAlias(parentKey, options), keyAlias(key, options)))
+		}
+	}
+}
+
+// defaultLinkColors are given in turn to link types without a configured style. They're
+// drawn dashed, and muted, so the Blocks structure stays dominant.
+var defaultLinkColors = []string{"#7FA7D0", "#B09AC4", "#D8A58C", "#8DBFB5", "#A99A8E"}
+
+// writeLinks draws the -linkTypes links between shown tickets, styled by type, and a legend for the styles.
+func writeLinks(output *bufio.Writer, issues *map[string]IssueInfo, shown map[string]struct{}, options Options) {
+	links := make(map[Link]struct{})
+	linkTypes := make(map[string]struct{})
+	for _, issue := range *issues {
+		for _, link := range issue.links {
+			_, fromShown := shown[link.from]
+			_, toShown := shown[link.to]
+			if fromShown && toShown {
+				links[link] = struct{}{}
+				linkTypes[link.linkType] = struct{}{}
+			}
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	styles := make(map[string]string)
+	for i, linkType := range sortedKeys(linkTypes) {
+		styles[linkType] = defaultLinkColors[i%len(defaultLinkColors)] + ",dashed"
+		for configType, style := range options.config.LinkStyles {
+			if strings.EqualFold(configType, linkType) {
+				styles[linkType] = style
+			}
+		}
+	}
+	var lines []string
+	for link := range links {
+		lines = append(lines, fmt.Sprintf("%s -[%s]-> %s", keyAlias(link.from, options), styles[link.linkType], keyAlias(link.to, options)))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		_, _ = output.WriteString(line + "\n")
+	}
+
+	_, _ = output.WriteString("legend right\n")
+	_, _ = output.WriteString("  Blocks: arrowhead at the blocker\n")
+	for _, linkType := range sortedKeys(linkTypes) {
+		color, _, _ := strings.Cut(styles[linkType], ",")
+		if strings.HasPrefix(color, "#") {
+			_, _ = output.WriteString(fmt.Sprintf("  <color:%s>%s</color>%s\n", color, linkType, lineNote(styles[linkType])))
+		} else {
+			_, _ = output.WriteString(fmt.Sprintf("  %s (%s)\n", linkType, styles[linkType]))
+		}
+	}
+	_, _ = output.WriteString("endlegend\n")
+}
+
+// lineNote describes a line style's dashes or dots for the legend, where the color alone can't show them.
+func lineNote(style string) string {
+	for _, pattern := range []string{"dashed", "dotted"} {
+		if strings.Contains(style, pattern) {
+			return " (" + pattern + ")"
+		}
+	}
+	return ""
+}
+
+func writeHeader(output *bufio.Writer, options Options) error {
+	_, err := output.WriteString("@startuml\n")
 	if err != nil {
-		return fmt.Errorf("couldn't flush: %v\n", err)
+		return err
+	}
+	if len(options.theme) > 0 {
+		_, _ = output.WriteString(themeDirective(options.theme) + "\n")
+	}
+	_, _ = output.WriteString(fmt.Sprintf("skinparam wrapWidth %d\n", options.wrapWidth))
+	writePalette(output, options.palette)
+	if options.sizeByPoints {
+		_, _ = output.WriteString("skinparam objectBorderThickness<<L>> 2\n")
+		_, _ = output.WriteString("skinparam objectBorderThickness<<XL>> 3\n")
+	}
+	for _, stereotype := range sortedKeys(options.config.Stereotypes.Styles) {
+		styles := options.config.Stereotypes.Styles[stereotype]
+		for _, name := range sortedKeys(styles) {
+			_, _ = output.WriteString(fmt.Sprintf("skinparam object%s<<%s>> %s\n",
+				strings.TrimPrefix(name, "object"), stereotype, styles[name]))
+		}
+	}
+	for _, skinparam := range append(append([]string{}, options.config.Skinparams...), options.skinparams...) {
+		if !strings.HasPrefix(skinparam, "skinparam ") {
+			skinparam = "skinparam " + skinparam
+		}
+		_, _ = output.WriteString(skinparam + "\n")
+	}
+	return writeFileContents(output, options.includeFilename)
+}
+
+func writePalette(output *bufio.Writer, palette Palette) {
+	for _, setting := range []struct{ names, color string }{
+		{"backgroundColor", palette.Background},
+		{"objectBackgroundColor packageBackgroundColor", palette.Node},
+		{"objectBorderColor packageBorderColor", palette.Border},
+		{"defaultFontColor objectFontColor objectAttributeFontColor packageFontColor arrowFontColor", palette.Font},
+		{"arrowColor", palette.Edge},
+	} {
+		if len(setting.color) > 0 {
+			for _, name := range strings.Fields(setting.names) {
+				_, _ = output.WriteString(fmt.Sprintf("skinparam %s %s\n", name, setting.color))
+			}
+		}
+	}
+}
+
+func writeFooter(output *bufio.Writer, options Options) error {
+	err := writeFileContents(output, options.epilogueFilename)
+	if err != nil {
+		return err
+	}
+	_, err = output.WriteString("@enduml\n")
+	return err
+}
+
+// writeFileContents copies a file (if named) into the output, ending it with a newline.
+func writeFileContents(output *bufio.Writer, filename string) error {
+	if len(filename) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %v", filename, err)
+	}
+	_, _ = output.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		_, _ = output.WriteString("\n")
 	}
 	return nil
 }
 
-func normalizeKey(key string) string {
-	return strings.ReplaceAll(key, "-", "")
+// themeDirective accepts a theme name, "name from URL", or the URL of a
+// puml-theme-NAME.puml file; any other URL is included as is.
+func themeDirective(theme string) string {
+	if !strings.Contains(theme, "://") || strings.Contains(theme, " from ") {
+		return "!theme " + theme
+	}
+	directory, file := theme[:strings.LastIndex(theme, "/")], theme[strings.LastIndex(theme, "/")+1:]
+	if name, isTheme := strings.CutPrefix(strings.TrimSuffix(file, ".puml"), "puml-theme-"); isTheme {
+		return fmt.Sprintf("!theme %s from %s", name, directory)
+	}
+	return "!include " + theme
+}
+
+// isShown reports whether a ticket is drawn: it has links, or is kept despite -hideOrphans.
+func isShown(issue *IssueInfo, parents map[string]struct{}, options Options) bool {
+	_, showIt := (options.showKeys)[issue.issueKey]
+	_, isRoot := (options.roots)[issue.issueKey]
+	_, isListed := (options.fileKeys)[issue.issueKey]
+	_, isParent := parents[issue.issueKey]
+	hasParent := len(issue.parent) > 0 || isParent
+	return showIt || isRoot || isListed || !options.hideOrphans || len(issue.blockedKeys) > 0 || len(issue.blockerKeys) > 0 ||
+		len(issue.links) > 0 || (options.parentLinks && hasParent)
+}
+
+// shownIssues returns the keys of the tickets isShown draws.
+func shownIssues(issues *map[string]IssueInfo, options Options) map[string]struct{} {
+	shown := make(map[string]struct{})
+	parents := parentKeys(issues)
+	for key, issue := range *issues {
+		if isShown(&issue, parents, options) {
+			shown[key] = struct{}{}
+		}
+	}
+	return shown
+}
+
+func writeObject(output *bufio.Writer, issue *IssueInfo, indent string, highestCentrality float64, options Options) {
+	highlight := nodeColor(issue, highestCentrality, options)
+	if isStale(issue, options) && len(highlight) > 0 {
+		highlight += ";line:red;line.bold"
+	} else if isStale(issue, options) {
+		highlight = "#line:red;line.bold"
+	}
+	stereotype := ""
+	if size := pointsSize(issue.points); options.sizeByPoints && len(size) > 0 {
+		stereotype = " <<" + size + ">>"
+	}
+	for _, name := range configStereotypes(issue, options) {
+		stereotype += " <<" + name + ">>"
+	}
+	// the alias is only the PlantUML name; the diagram shows the real key
+	title := issue.issueKey
+	if len(issue.badges) > 0 {
+		title += " " + strings.Join(issue.badges, " ")
+	}
+	name := fmt.Sprintf("\"%s\" as %s", strings.ReplaceAll(title, "\"", "'"), keyAlias(issue.issueKey, options))
+	if tip := tooltip(issue, options); len(tip) > 0 {
+		stereotype += " [[{" + strings.NewReplacer("{", "(", "}", ")", "[", "(", "]", ")").Replace(tip) + "}]]"
+	}
+	_, _ = output.WriteString(fmt.Sprintf("%sobject %s%s %s {\n", indent, name, stereotype, highlight))
+	icon := ""
+	for issueType, typeIcon := range options.config.IssueTypeIcons {
+		if strings.EqualFold(issueType, issue.issueType) {
+			icon = typeIcon + " "
+		}
+	}
+	_, _ = output.WriteString(fmt.Sprintf("%s  %s%s%s\n", indent, icon, statusIcon(issue, options),
+		strings.ToUpper(effectiveStatus(issue))))
+	if options.showImpact {
+		_, _ = output.WriteString(fmt.Sprintf("%s  impact: %d open\n", indent, issue.impact))
+	}
+	if options.showSlack && issue.scheduled {
+		_, _ = output.WriteString(fmt.Sprintf("%s  slack: %dd\n", indent, issue.slack))
+	}
+	if options.showAge && !issue.created.IsZero() {
+		_, _ = output.WriteString(fmt.Sprintf("%s  opened %dd ago\n", indent, daysSince(issue.created, options)))
+	}
+	if isStale(issue, options) {
+		_, _ = output.WriteString(fmt.Sprintf("%s  untouched %dd\n", indent, daysSince(issue.updated, options)))
+	}
+	if !options.hideSummary && len(issue.summary) > 0 {
+		for _, line := range wrapWide(issue.summary, options.wrapWidth/pixelsPerColumn) {
+			_, _ = output.WriteString(fmt.Sprintf("%s  %s\n", indent, line))
+		}
+	}
+	if len(issue.duplicateKeys) > 0 {
+		_, _ = output.WriteString(fmt.Sprintf("%s  duplicates: %s\n", indent, strings.Join(issue.duplicateKeys, ", ")))
+	}
+	_, _ = output.WriteString(indent + "}\n")
+}
+
+// nodeColor returns a ticket's PlantUML background color ("#name" or "#RRGGBB"), or "" for the default:
+// highlights first, then metrics shading, the project's color and the palette's status color.
+func nodeColor(issue *IssueInfo, highestCentrality float64, options Options) string {
+	highlight := getHighlight(issue.issueKey, options)
+	if len(highlight) == 0 && isNew(issue.issueKey, options) {
+		highlight = "#" + strings.TrimPrefix(options.highlightColor, "#")
+	}
+	if color, found := options.highlightAssignees[strings.ToLower(issue.assignee)]; len(highlight) == 0 && found {
+		if len(color) == 0 {
+			color = options.highlightColor
+		}
+		highlight = "#" + strings.TrimPrefix(color, "#")
+	}
+	for _, label := range issue.labels {
+		if color, found := options.highlightLabels[strings.ToLower(label)]; len(highlight) == 0 && found {
+			if len(color) == 0 {
+				color = options.highlightColor
+			}
+			highlight = "#" + strings.TrimPrefix(color, "#")
+		}
+	}
+	if options.showSlack && issue.scheduled && len(highlight) == 0 {
+		if issue.slack < 0 {
+			highlight = "#Tomato"
+		} else if issue.slack == 0 {
+			highlight = "#Orange"
+		}
+	}
+	if color := ageColor(issue, options); len(highlight) == 0 && len(color) > 0 {
+		highlight = "#" + strings.TrimPrefix(color, "#")
+	}
+	if len(highlight) == 0 && options.metricsShading {
+		highlight = shading(issue.centrality, highestCentrality)
+	}
+	if color := options.config.Projects[projectKey(issue.issueKey)].Color; len(highlight) == 0 && len(color) > 0 {
+		highlight = "#" + strings.TrimPrefix(color, "#")
+	}
+	if color := options.palette.Statuses[statusCategory(issue, options)]; len(highlight) == 0 && len(color) > 0 {
+		highlight = "#" + strings.TrimPrefix(color, "#")
+	}
+	return highlight
+}
+
+// configStereotypes returns the config's stereotypes for a ticket: by issue type, by status and
+// for placeholders.
+func configStereotypes(issue *IssueInfo, options Options) []string {
+	config := options.config.Stereotypes
+	var names []string
+	for _, match := range []struct {
+		value   string
+		mapping map[string]string
+	}{{issue.issueType, config.IssueTypes}, {issue.status, config.Statuses}} {
+		for name, stereotype := range match.mapping {
+			if strings.EqualFold(name, match.value) && !containsKey(&names, stereotype) {
+				names = append(names, stereotype)
+			}
+		}
+	}
+	if issue.placeholder && len(config.Placeholder) > 0 && !containsKey(&names, config.Placeholder) {
+		names = append(names, config.Placeholder)
+	}
+	return names
+}
+
+// statusIcon returns the config's icon for a ticket's status category, followed by a space, or "".
+func statusIcon(issue *IssueInfo, options Options) string {
+	category := statusCategory(issue, options)
+	for name, icon := range options.config.StatusIcons {
+		if strings.EqualFold(name, category) && len(category) > 0 {
+			return icon + " "
+		}
+	}
+	return ""
+}
+
+// pixelsPerColumn is roughly how wide a narrow character is in PlantUML's default font, to
+// turn -wrapWidth into a number of columns.
+const pixelsPerColumn = 7
+
+// wrapWide breaks text into lines at most columns wide where runs of wide (CJK) characters,
+// which PlantUML won't break as it does text at spaces, exceed that. Other text is left to
+// PlantUML. Zero-width runes, like combining marks or the joiners of emoji sequences, stay with
+// the character before them.
+func wrapWide(text string, columns int) []string {
+	var lines []string
+	var line strings.Builder
+	width, previous := 0, rune(0)
+	for _, r := range text {
+		runeColumns := runeWidth(r)
+		if unicode.IsSpace(r) {
+			width = 0
+		} else if runeColumns == 2 && width > 0 && width+runeColumns > columns && previous != '\u200D' {
+			lines = append(lines, line.String())
+			line.Reset()
+			width = 0
+		}
+		line.WriteRune(r)
+		if !unicode.IsSpace(r) {
+			width += runeColumns
+		}
+		previous = r
+	}
+	return append(lines, line.String())
+}
+
+// runeWidth returns how many columns a rune takes in a monospaced terminal: 2 for East Asian
+// wide and fullwidth characters and most emoji, 0 for combining marks, joiners and variation
+// selectors, 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || (r >= 0xFE00 && r <= 0xFE0F):
+		return 0
+	case (r >= 0x1100 && r <= 0x115F) || (r >= 0x2E80 && r <= 0xA4CF && r != 0x303F) ||
+		(r >= 0xAC00 && r <= 0xD7A3) || (r >= 0xF900 && r <= 0xFAFF) || (r >= 0xFE30 && r <= 0xFE4F) ||
+		(r >= 0xFF00 && r <= 0xFF60) || (r >= 0xFFE0 && r <= 0xFFE6) || (r >= 0x1F300 && r <= 0x1F64F) ||
+		(r >= 0x1F680 && r <= 0x1F6FF) || (r >= 0x1F900 && r <= 0x1F9FF) || (r >= 0x20000 && r <= 0x3FFFD):
+		return 2
+	}
+	return 1
+}
+
+// tooltipLength is how many characters of a description a tooltip shows.
+const tooltipLength = 300
+
+// tooltip returns the start of a ticket's description on one line, for hovering in rendered
+// diagrams, or "" when there's none or summaries are hidden.
+func tooltip(issue *IssueInfo, options Options) string {
+	if options.hideSummary {
+		return ""
+	}
+	text := []rune(strings.Join(strings.Fields(issue.description), " "))
+	if len(text) > tooltipLength {
+		return string(text[:tooltipLength-1]) + "…"
+	}
+	return string(text)
+}
+
+func effectiveStatus(issue *IssueInfo) string {
+	if len(issue.status) > 0 {
+		return issue.status
+	}
+	return "unknown"
+}
+
+// normalizeKey makes a PlantUML name of a key in the -aliasStyle style. Issue ids, used when there
+// are no keys, get a prefix since names can't start with a digit.
+func normalizeKey(key string, style string) string {
+	if len(key) > 0 && key[0] >= '0' && key[0] <= '9' {
+		return "id" + key
+	}
+	if style == "underscore" {
+		return strings.NewReplacer("-", "_", "/", "__").Replace(key)
+	}
+	return strings.NewReplacer("-", "", "/", "_").Replace(key)
+}
+
+// keyAliases names every ticket for PlantUML and Mermaid, in key order, numbering the names
+// normalizeKey gives more than one key, so "AB-12" stays AB12 and "AB1-2" becomes AB12_2.
+func keyAliases(issues *map[string]IssueInfo, options Options) map[string]string {
+	aliases := make(map[string]string)
+	taken := make(map[string]struct{})
+	for _, key := range sortedKeys(*issues) {
+		alias := normalizeKey(key, options.aliasStyle)
+		for n := 2; ; n++ {
+			if _, collides := taken[alias]; !collides {
+				break
+			}
+			alias = fmt.Sprintf("%s_%d", normalizeKey(key, options.aliasStyle), n)
+		}
+		aliases[key] = alias
+		taken[alias] = struct{}{}
+	}
+	return aliases
+}
+
+// keyAlias returns a ticket's name from keyAliases, or its normalizeKey name for tickets
+// outside them, like parents without rows.
+func keyAlias(key string, options Options) string {
+	if alias, found := options.aliases[key]; found {
+		return alias
+	}
+	return normalizeKey(key, options.aliasStyle)
 }
 
 func parseKeys(keys string) map[string]struct{} {
@@ -350,13 +6542,283 @@ func parseKeys(keys string) map[string]struct{} {
 	return keyMap
 }
 
+// isNew reports whether -highlightNew applies to a ticket key or a "blocker blocked" link.
+// Nothing is new on the first run, when there is no previous state.
+func isNew(entry string, options Options) bool {
+	if !options.highlightNew || options.previousState == nil {
+		return false
+	}
+	_, seen := options.previousState[entry]
+	return !seen
+}
+
+// notifyLimit is how many links or cycles of each kind a notification lists.
+const notifyLimit = 20
+
+// notifyChanges posts the blocking links added and removed since the previous -stateFile run,
+// and the cycles the added ones close, to the -notify webhook. Nothing is posted on the first
+// run or when nothing changed.
+func notifyChanges(issues *map[string]IssueInfo, options Options) error {
+	if options.previousState == nil {
+		return nil
+	}
+	current := make(map[string]struct{})
+	var added, removed, cycles []string
+	closed := make(map[string]struct{})
+	for _, key := range sortedKeys(*issues) {
+		for _, blockedKey := range (*issues)[key].blockedKeys {
+			link := key + " " + blockedKey
+			current[link] = struct{}{}
+			if _, seen := options.previousState[link]; seen {
+				continue
+			}
+			added = append(added, key+" blocks "+blockedKey)
+			if cycle := closeCycle(issues, key, blockedKey, closed); len(cycle) > 0 {
+				cycles = append(cycles, cycle)
+			}
+		}
+	}
+	for _, entry := range sortedKeys(options.previousState) {
+		blocker, blocked, isLink := strings.Cut(entry, " ")
+		if _, found := current[entry]; isLink && !found {
+			removed = append(removed, blocker+" no longer blocks "+blocked)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	text := fmt.Sprintf("Dependency graph changed: %d new blocking links, %d removed, %d new cycles",
+		len(added), len(removed), len(cycles))
+	for _, lines := range [][]string{added, removed, cycles} {
+		for i, line := range lines {
+			if i == notifyLimit {
+				text += fmt.Sprintf("\n… and %d more", len(lines)-notifyLimit)
+				break
+			}
+			text += "\n• " + line
+		}
+	}
+	message, _ := json.Marshal(map[string]string{"text": text})
+	response, err := http.Post(options.notifyUrl, "application/json", bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("couldn't post: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return nil
+}
+
+// writeState records every ticket key, then every "blocker blocked" link, one per line,
+// in the format loadKeyFile reads.
+func writeState(issues *map[string]IssueInfo, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("couldn't create: %v", err)
+	}
+	output := bufio.NewWriter(file)
+	_, _ = output.WriteString("# tickets, then links (blocker blocked), from the last JiraD run\n")
+	keys := sortedKeys(*issues)
+	for _, key := range keys {
+		_, _ = output.WriteString(key + "\n")
+	}
+	for _, key := range keys {
+		for _, blockedKey := range (*issues)[key].blockedKeys {
+			_, _ = output.WriteString(key + " " + blockedKey + "\n")
+		}
+	}
+	err = output.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// parseColumns splits a comma delimited list of header names.
+func parseColumns(columns string) []string {
+	var names []string
+	for _, name := range strings.Split(columns, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseColors reads "name:color" pairs into a map keyed by lowercase name.
+// A pair without a color gets an empty one, left for the caller to fill in.
+func parseColors(specs string) map[string]string {
+	colors := make(map[string]string)
+	if len(specs) > 0 {
+		for _, spec := range strings.Split(specs, ",") {
+			name, color := spec, ""
+			if i := strings.LastIndex(spec, ":"); i != -1 {
+				name, color = spec[:i], spec[i+1:]
+			}
+			colors[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(color)
+		}
+	}
+	return colors
+}
+
 func getHighlight(key string, options Options) string {
 	var highlight string
 	_, highlightIt := (options.highlightKeys)[key]
-	if highlightIt {
-		highlight = fmt.Sprintf("#%s", options.highlightColor)
+	if color, colored := options.highlightKeyColors[key]; colored && len(color) > 0 {
+		highlight = fmt.Sprintf("#%s", strings.TrimPrefix(color, "#"))
+	} else if highlightIt {
+		highlight = fmt.Sprintf("#%s", strings.TrimPrefix(options.highlightColor, "#"))
 	} else {
 		highlight = ""
 	}
 	return highlight
 }
+
+func writeRollup(issues *map[string]IssueInfo, outFile io.Writer, options Options) error {
+	var groupFor func(issue *IssueInfo) string
+	switch options.rollup {
+	case "parent":
+		parents := parentKeys(issues)
+		groupFor = func(issue *IssueInfo) string {
+			if group := parentGroup(issue, issues, parents); len(group) > 0 {
+				return group
+			}
+			return "No parent"
+		}
+	default:
+		groupFor = func(issue *IssueInfo) string { return teamFor(issue, options.teamMap) }
+	}
+
+	// count the links between each pair of groups
+	groups := make(map[string]struct{})
+	weights := make(map[string]map[string]int)
+	for _, issue := range *issues {
+		blockerGroup := groupFor(&issue)
+		groups[blockerGroup] = struct{}{}
+		for _, blockedKey := range issue.blockedKeys {
+			blocked := (*issues)[blockedKey]
+			blocked.issueKey = blockedKey
+			blockedGroup := groupFor(&blocked)
+			if blockedGroup == blockerGroup {
+				continue
+			}
+			if _, found := weights[blockerGroup]; !found {
+				weights[blockerGroup] = make(map[string]int)
+			}
+			weights[blockerGroup][blockedGroup]++
+		}
+	}
+
+	output := bufio.NewWriter(outFile)
+
+	// write header
+	err := writeHeader(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	// write each group as an object
+	for _, group := range sortedKeys(groups) {
+		_, _ = output.WriteString(fmt.Sprintf("object \"%s\" as %s\n", group, normalizeName(group)))
+	}
+	// write each group relationship, weighted by its number of links
+	for _, blockerGroup := range sortedKeys(groups) {
+		for _, blockedGroup := range sortedKeys(groups) {
+			if weight, found := weights[blockerGroup][blockedGroup]; found {
+				_, _ = output.WriteString(fmt.Sprintf("%s <|-- %s : %d\n", normalizeName(blockerGroup),
+					normalizeName(blockedGroup), weight))
+			}
+		}
+	}
+	// write end
+	err = writeFooter(output, options)
+	if err != nil {
+		return fmt.Errorf("output failure: %v", err)
+	}
+
+	err = output.Flush()
+	if err != nil {
+		return fmt.Errorf("couldn't flush: %v\n", err)
+	}
+	return nil
+}
+
+// loadMapFile reads name=value lines, of the given form, skipping blanks and '#' comments.
+func loadMapFile(filename string, form string) (map[string]string, error) {
+	values := make(map[string]string)
+	if len(filename) == 0 {
+		return values, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return values, fmt.Errorf("couldn't open: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	err = readLines(file, func(line string) error {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			return nil
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("expected %s: %s", form, line)
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		return nil
+	})
+	return values, err
+}
+
+func teamFor(issue *IssueInfo, teamMap map[string]string) string {
+	if len(issue.team) > 0 {
+		return issue.team
+	}
+	if team, found := teamMap[projectKey(issue.issueKey)]; found {
+		return team
+	}
+	return "No team"
+}
+
+// projectKey returns a key's project, without any -sitePrefix, so project config applies on every site.
+func projectKey(key string) string {
+	project, _, _ := strings.Cut(key[strings.Index(key, "/")+1:], "-")
+	return project
+}
+
+// normalizeName reduces free text (e.g. a team name) to a PlantUML-safe identifier.
+func normalizeName(name string) string {
+	var normalized strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			normalized.WriteRune(r)
+		} else if r > unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			// other scripts are spelled out, so names of CJK teams or epics stay apart
+			normalized.WriteString(fmt.Sprintf("u%X", r))
+		}
+	}
+	if normalized.Len() == 0 {
+		return "_"
+	}
+	return normalized.String()
+}
+
+func keysOf[V any](m map[string]V) map[string]struct{} {
+	keys := make(map[string]struct{}, len(m))
+	for key := range m {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSites serves the unprefixed site and a site per profile of a config whose profiles read
+// their own exports, and whose keyA may only use sitea.
+func serveSites(t *testing.T) *http.ServeMux {
+	dir := t.TempDir()
+	for name, key := range map[string]string{"a.csv": "AAA-1", "b.csv": "BBB-1"} {
+		export := "Issue key,Status,Outward issue link (Blocks)\n" + key + ",To Do," + key + "0\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(export), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := `{"profiles": {"sitea": {"in": "` + filepath.Join(dir, "a.csv") + `"},
+		"siteb": {"in": "` + filepath.Join(dir, "b.csv") + `"}},
+		"apiKeys": {"keyA": {"profiles": ["sitea"]}}}`
+	configFilename := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFilename, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadConfig(configFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-config=" + configFilename, "-quiet"}
+	mux := http.NewServeMux()
+	serveSite(mux, "", args, loaded)
+	for _, name := range sortedKeys(loaded.Profiles) {
+		serveSite(mux, name, append(append([]string{}, args...), "-profile="+name), loaded)
+	}
+	return mux
+}
+
+func get(mux *http.ServeMux, target string, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	request.Header.Set("Authorization", "Bearer "+key)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestServeKeyStaysOnItsSite(t *testing.T) {
+	mux := serveSites(t)
+	if response := get(mux, "/sitea/graph", "keyA"); response.Code != http.StatusOK ||
+		!strings.Contains(response.Body.String(), "AAA-1") {
+		t.Fatalf("own site: %d %s", response.Code, response.Body.String())
+	}
+	if response := get(mux, "/siteb/graph", "keyA"); response.Code != http.StatusUnauthorized {
+		t.Fatalf("other site: %d, want %d", response.Code, http.StatusUnauthorized)
+	}
+	response := get(mux, "/sitea/graph?profile=siteb", "keyA")
+	if response.Code != http.StatusBadRequest || strings.Contains(response.Body.String(), "BBB-1") {
+		t.Fatalf("other site's profile: %d %s", response.Code, response.Body.String())
+	}
+}
+
+func TestServeRefusesServerActions(t *testing.T) {
+	for _, option := range []string{"profile", "plantumlServer", "notify", "readBuffer", "in"} {
+		if err := checkOverrides(map[string]any{option: "http://127.0.0.1:1/internal"}); err == nil {
+			t.Errorf("requests may set %s", option)
+		}
+	}
+	for _, value := range []any{"A-1,@/etc/passwd", []any{"X-1", "@/etc/passwd"}} {
+		if err := checkOverrides(map[string]any{"hideKeys": value}); err == nil {
+			t.Errorf("requests may read key files with %v", value)
+		}
+	}
+	if response := get(serveSites(t), "/sitea/graph?hideKeys=X-1&hideKeys=@/etc/passwd", "keyA"); response.Code != http.StatusBadRequest {
+		t.Errorf("key file in a list: %d, want %d", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestProvenanceRedactsNotify(t *testing.T) {
+	options, err := parseRequestOptions([]string{"-notify=https://hooks.example.com/SECRETTOKEN", "-stateFile=state.txt"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := strings.Join(provenance(options), "\n"); strings.Contains(text, "SECRETTOKEN") {
+		t.Fatalf("provenance shows the webhook: %s", text)
+	}
+}
+
+func TestServeMetricsCountRendering(t *testing.T) {
+	mux := serveSites(t)
+	for range 2 {
+		if response := get(mux, "/sitea/graph", "keyA"); response.Code != http.StatusOK {
+			t.Fatalf("/sitea/graph: %d %s", response.Code, response.Body)
+		}
+	}
+	if response := get(mux, "/siteb/metrics", "keyA"); response.Code != http.StatusUnauthorized {
+		t.Fatalf("keyA read another site's metrics: %d", response.Code)
+	}
+	response := get(mux, "/sitea/metrics", "keyA")
+	for _, line := range []string{"jirad_diagrams_rendered_total 1\n", "jirad_cache_hits_total 1\n", "jirad_parse_errors_total 0\n"} {
+		if !strings.Contains(response.Body.String(), line) {
+			t.Errorf("metrics lack %q:\n%s", line, response.Body)
+		}
+	}
+}
+
+// TestWriteOutputsConcurrently writes one parse to outputs of several formats at once, for -race.
+func TestWriteOutputsConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	export := "Issue key,Summary,Outward issue link (Blocks),Outward issue link (Duplicate)\n" +
+		"A-1,original,A-4,\nA-3,copy,,A-1\nA-2,copy,A-5,A-1\nA-4,blocked,,\nA-5,blocked,A-4,\n"
+	inFilename := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(inFilename, []byte(export), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-in=" + inFilename, "-mergeDuplicates", "-quiet"}
+	names := []string{"a.puml", "b.puml", "c.json", "d.dot", "e.mmd", "f.csv", "g.ics", "h.xml"}
+	for _, name := range names {
+		args = append(args, "-out="+filepath.Join(dir, name))
+	}
+	options, err := parseRequestOptions(args, nil)
+	if err == nil {
+		err = validateOptions(options)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runDiagram(options); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names[:2] {
+		diagram, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(diagram), "duplicates: A-2, A-3") {
+			t.Errorf("%s lacks the sorted duplicates:\n%s", name, diagram)
+		}
+	}
+}
+
+func TestFailIfBlockedRefusesHideKeys(t *testing.T) {
+	options, err := parseRequestOptions([]string{"-hideKeys=X-1", "-failIfBlocked=REL-1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateOptions(options); err == nil {
+		t.Fatal("a hidden open blocker would pass the gate")
+	}
+}
+
+func TestParentFromEitherColumn(t *testing.T) {
+	dir := t.TempDir()
+	export := "Issue key,Status,Parent,Custom field (Epic Link),Outward issue link (Blocks)\n" +
+		"S-1,To Do,E-1,,S-2\nS-2,To Do,,E-2,\n"
+	inFilename, outFilename := filepath.Join(dir, "in.csv"), filepath.Join(dir, "out.json")
+	if err := os.WriteFile(inFilename, []byte(export), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	options, err := parseRequestOptions([]string{"-in=" + inFilename, "-out=" + outFilename, "-quiet"}, nil)
+	if err == nil {
+		err = runDiagram(options)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := os.ReadFile(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, parent := range []string{`"parent": "E-1"`, `"parent": "E-2"`} {
+		if !strings.Contains(string(graph), parent) {
+			t.Errorf("graph lacks %s:\n%s", parent, graph)
+		}
+	}
+}
+
+func TestReproducibleNowFollowsInput(t *testing.T) {
+	updated := time.Date(2024, 2, 2, 10, 0, 0, 0, time.UTC)
+	issues := map[string]IssueInfo{
+		"A-1": {issueKey: "A-1", created: updated.AddDate(0, -1, 0), updated: updated},
+		"A-2": {issueKey: "A-2", created: updated.AddDate(0, -2, 0)},
+	}
+	options := Options{reproducible: true, now: time.Now()}
+	if now := inputNow(&issues, options); !now.Equal(updated) {
+		t.Fatalf("now is %v, want the latest update %v", now, updated)
+	}
+}
+
+func TestDetailCardHasTheJsonFields(t *testing.T) {
+	issue := IssueInfo{issueKey: "A-1", description: "why", sprints: []string{"S1"}, badges: []string{"risk"},
+		duplicateKeys: []string{"A-2"}, due: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)}
+	ticket := newJsonTicket("A-1", &issue, Options{})
+	if ticket.Description != "why" || len(ticket.Sprints) != 1 || len(ticket.Badges) != 1 ||
+		len(ticket.Duplicates) != 1 || ticket.Due != "2024-03-10" {
+		t.Fatalf("ticket lacks parsed fields: %+v", ticket)
+	}
+}
+
+func TestServeRefusesLargeUploads(t *testing.T) {
+	mux := http.NewServeMux()
+	serveSite(mux, "", []string{"-maxUpload=1KB", "-quiet"}, Config{})
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	input, _ := form.CreateFormFile("input", "in.csv")
+	_, _ = input.Write([]byte("Issue key\n" + strings.Repeat("A-1\n", 1000)))
+	_ = form.Close()
+	request := httptest.NewRequest(http.MethodPost, "/graphs", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large upload: %d %s", recorder.Code, recorder.Body)
+	}
+}